@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// NewBatchSim returns a new Sim, with its own network, envs and logs, that does
+// just the given run with the same configuration, params and master seed as this
+// one.  Its log files (for each of lognms) get the run number as a suffix.
+// If prep is non-nil, it is called on the new sim before it is configured, e.g.,
+// to change its params or config for one point of a sweep (see RunSweep).
+func (ss *Sim) NewBatchSim(run int, lognms []string, prep func(bs *Sim)) *Sim {
+	bs := &Sim{}
+	bs.New()
+	bs.Params = ss.Params
+	bs.ApplyExptConfig(ss.ExptConfig())
+	bs.RndSeed = ss.RndSeed
+	bs.MaxRuns = run + 1 // stops after this run
+	bs.SaveWts = ss.SaveWts
+	bs.NoGui = ss.NoGui
+	bs.LogSetParams = ss.LogSetParams
+	bs.OutDir = ss.OutDir
+	bs.CkptEpcs = ss.CkptEpcs
+	bs.CkptSlpCycs = ss.CkptSlpCycs
+	bs.LogSfx = fmt.Sprintf("_run%03d", run)
+	if prep != nil {
+		prep(bs)
+	}
+	bs.Config()
+	bs.Init()
+	if run != 0 {
+		bs.TrainEnv.Run.Cur = run
+		bs.NewRun()
+	}
+	bs.OpenLogFiles(lognms)
+	return bs
+}
+
+// RunBatch does the remaining runs, from TrainEnv.Run.Cur up to MaxRuns, with up
+// to nprocs of them running at the same time (0 = one per CPU core), each on its own
+// Sim from NewBatchSim.  Every run derives its seeds from the master seed and its run
+// number, so the results are the same as doing the runs one after the other.
+// The RunLogs of all the runs are merged, in run order, into this sim's RunLog.
+// If interrupted (see Interrupt), each run that is underway saves a checkpoint,
+// and the runs that haven't started are skipped.
+func (ss *Sim) RunBatch(nprocs int, lognms []string) {
+	first := ss.TrainEnv.Run.Cur
+	nruns := ss.MaxRuns - first
+	if nprocs <= 0 {
+		nprocs = runtime.NumCPU()
+	}
+	if nprocs > nruns {
+		nprocs = nruns
+	}
+	fmt.Printf("Running %d Runs, %d at a time\n", nruns, nprocs)
+
+	runlogs := make([]*etable.Table, nruns)
+	runs := make(chan int)
+	var wg sync.WaitGroup
+	for p := 0; p < nprocs; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range runs {
+				if ss.IsInterrupted() { // skip the runs that haven't started
+					continue
+				}
+				bs := ss.NewBatchSim(run, lognms, nil)
+				if ss.AddBatchSim(bs) {
+					bs.Train()
+					ss.DeleteBatchSim(bs)
+				}
+				if bs.IsInterrupted() {
+					bs.SaveInterrupted(true)
+				}
+				bs.CloseLogFiles()
+				runlogs[run-first] = bs.RunLog
+			}
+		}()
+	}
+	for run := first; run < ss.MaxRuns; run++ {
+		runs <- run
+	}
+	close(runs)
+	wg.Wait()
+
+	dt := ss.RunLog
+	dt.SetNumRows(0)
+	for _, rl := range runlogs {
+		if rl == nil {
+			continue
+		}
+		for row := 0; row < rl.Rows; row++ {
+			AppendLogRow(dt, rl, row)
+			WriteLogRow(ss.RunFile, dt, dt.Rows-1)
+		}
+	}
+	ss.RunStatsFmLog(dt)
+	ss.GoUpdatePlot(ss.RunPlot)
+}
+
+// AppendLogRow adds a copy of the given row of log fm to the end of log dt, which
+// must have the same columns.  Int64 columns (the seeds) are copied directly, as
+// etable's CopyCell goes through float64.
+func AppendLogRow(dt, fm *etable.Table, row int) {
+	drow := dt.Rows
+	dt.SetNumRows(drow + 1)
+	for ci, col := range dt.Cols {
+		cnm := dt.ColNames[ci]
+		if i64, ok := col.(*etensor.Int64); ok {
+			if fc, ok := fm.ColByName(cnm).(*etensor.Int64); ok {
+				i64.Values[drow] = fc.Values[row]
+				continue
+			}
+		}
+		dt.CopyCell(cnm, drow, fm, cnm, row)
+	}
+}
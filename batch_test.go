@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+func TestNewBatchSim(t *testing.T) {
+	ss := newTestSim(t, 21)
+	ss.OutDir = "out"
+	for _, run := range []int{0, 3} {
+		bs := ss.NewBatchSim(run, nil, nil)
+		if bs.TrainEnv.Run.Cur != run || bs.MaxRuns != run+1 {
+			t.Errorf("run %d: Run.Cur = %d, MaxRuns = %d -- want just the one run", run, bs.TrainEnv.Run.Cur, bs.MaxRuns)
+		}
+		want := fmt.Sprintf("out/%s_Base_run%03d_epc.tsv", ss.Net.Nm, run)
+		if fnm := bs.LogFileName("epc"); fnm != want {
+			t.Errorf("run %d: epc log file = %s, want %s", run, fnm, want)
+		}
+		if got, want := bs.RunSeeds["Wts"], DeriveSeed(21, run, "Wts"); got != want {
+			t.Errorf("run %d: Wts seed = %d, want %d", run, got, want)
+		}
+	}
+	if fnm, want := ss.LogFileName("run"), "out/"+ss.Net.Nm+"_Base_run.tsv"; fnm != want {
+		t.Errorf("the sim running the batch saves its run log to %s, want %s", fnm, want)
+	}
+}
+
+// TestRunBatch does three short runs at the same time, which finish in any
+// order, and then one after the other -- the merged RunLogs must come out in run
+// order, and every run must log the same training either way
+func TestRunBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	runBatch := func(nprocs int) *Sim {
+		ss := newTestSim(t, 5)
+		ss.MaxRuns = 3
+		ss.MaxEpcs = 2
+		ss.TrialPerEpc = 5
+		ss.TestInterval = 0 // testing takes far longer than these runs
+		ss.OutDir = filepath.Join(dir, fmt.Sprint(nprocs))
+		os.Mkdir(ss.OutDir, 0755)
+		ss.RunBatch(nprocs, []string{"epc"})
+		return ss
+	}
+	par := runBatch(3)
+	if par.RunLog.Rows != 3 {
+		t.Fatalf("%d rows in the RunLog, want 3", par.RunLog.Rows)
+	}
+	for row := 0; row < 3; row++ {
+		if run := par.RunLog.CellFloat("Run", row); run != float64(row) {
+			t.Errorf("row %d of the RunLog is run %g", row, run)
+		}
+		if got, want := par.RunLog.ColByName("EnvSeed").(*etensor.Int64).Values[row], DeriveSeed(5, row, "Env"); got != want {
+			t.Errorf("row %d EnvSeed = %d, want %d", row, got, want)
+		}
+	}
+	seq := runBatch(1)
+	var pb, sb bytes.Buffer
+	par.RunLog.WriteCSV(&pb, etable.Tab, true)
+	seq.RunLog.WriteCSV(&sb, etable.Tab, true)
+	if pb.String() != sb.String() {
+		t.Errorf("runs at the same time logged:\n%s\none after the other:\n%s", pb.String(), sb.String())
+	}
+	for run := 0; run < 3; run++ {
+		sfx := fmt.Sprintf("_run%03d", run)
+		pf, err := ioutil.ReadFile(par.OutFile(par.Net.Nm + "_Base" + sfx + "_epc.tsv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sf, err := ioutil.ReadFile(seq.OutFile(seq.Net.Nm + "_Base" + sfx + "_epc.tsv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Count(pf, []byte("\n")) != 3 { // headers and 2 epochs
+			t.Errorf("run %d logged:\n%s\nwant 2 epochs", run, pf)
+		}
+		if !bytes.Equal(pf, sf) {
+			t.Errorf("run %d trained differently at the same time as the others:\n%s\nthan on its own:\n%s", run, pf, sf)
+		}
+	}
+}
+
+func TestAppendLogRow(t *testing.T) {
+	sch := etable.Schema{
+		{"Seed", etensor.INT64, nil, nil},
+		{"Params", etensor.STRING, nil, nil},
+		{"Err", etensor.FLOAT64, nil, nil},
+	}
+	fm := etable.New(sch, 2)
+	big := int64(1)<<62 + 1 // not a float64
+	fm.ColByName("Seed").(*etensor.Int64).Values[1] = big
+	fm.SetCellString("Params", 1, "Base")
+	fm.SetCellFloat("Err", 1, math.NaN())
+	dt := etable.New(sch, 1)
+	AppendLogRow(dt, fm, 1)
+	if dt.Rows != 2 {
+		t.Fatalf("%d rows, want 2", dt.Rows)
+	}
+	if got := dt.ColByName("Seed").(*etensor.Int64).Values[1]; got != big {
+		t.Errorf("Seed = %d, want %d", got, big)
+	}
+	if got := dt.CellString("Params", 1); got != "Base" {
+		t.Errorf("Params = %q, want Base", got)
+	}
+	if got := dt.CellFloat("Err", 1); !math.IsNaN(got) {
+		t.Errorf("Err = %g, want NaN", got)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// CalibParams are the settings of the calibration of the sleep stability
+// thresholds.  Before the first sleep of each run, a short segment of sleep is
+// run without learning, and Slp.PlusThr and MinusThr are set from percentiles
+// of its AvgLaySim.  The network is then put back the way it was, so the sleep
+// itself starts as it would have without the calibration.  The segment always
+// runs to the end, even if the sim is stopped -- it is not checkpointed.
+type CalibParams struct {
+	On       bool    `desc:"whether to calibrate the thresholds before the first sleep of each run -- else Slp.PlusThr and MinusThr are used as they are"`
+	Cycles   int     `def:"2000" min:"1" desc:"number of cycles of sleep in the calibration segment"`
+	Skip     int     `def:"200" min:"0" desc:"number of cycles at the start of the segment that are left out of the distribution, while the network settles into an attractor"`
+	PlusPct  float64 `def:"0.997" min:"0" max:"1" desc:"percentile (0-1) of the AvgLaySim distribution that PlusThr is set to -- the default is about where the default PlusThr falls for the default network"`
+	MinusPct float64 `def:"0.43" min:"0" max:"1" desc:"percentile (0-1) of the AvgLaySim distribution that MinusThr is set to -- must be below PlusPct"`
+}
+
+// Defaults sets the default calibration params
+func (cp *CalibParams) Defaults() {
+	cp.On = false
+	cp.Cycles = 2000
+	cp.Skip = 200
+	cp.PlusPct = 0.997
+	cp.MinusPct = 0.43
+}
+
+// Validate returns a description of each problem with the calibration params
+func (cp *CalibParams) Validate() []string {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	if cp.Skip < 0 || cp.Cycles <= cp.Skip {
+		bad("Slp.Calib.Cycles must be > Skip (%d), and Skip >= 0, are: %d, %d", cp.Skip, cp.Cycles, cp.Skip)
+	}
+	for _, pc := range []struct {
+		nm string
+		v  float64
+	}{{"PlusPct", cp.PlusPct}, {"MinusPct", cp.MinusPct}} {
+		if math.IsNaN(pc.v) || pc.v < 0 || pc.v > 1 {
+			bad("Slp.Calib.%s must be between 0 and 1, is: %g", pc.nm, pc.v)
+		}
+	}
+	if !(cp.MinusPct < cp.PlusPct) {
+		bad("Slp.Calib.MinusPct must be < PlusPct, are: %g, %g", cp.MinusPct, cp.PlusPct)
+	}
+	return errs
+}
+
+// Percentile returns the value at the given fraction (0-1) of the way through
+// the sorted values, interpolating between the two nearest ones
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	pos := p * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (pos-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
+
+// SetSlpThr sets the stability thresholds for a sleep that is about to start:
+// those of Slp, or, with Slp.Calib.On, the calibrated ones, calibrating them
+// first if that hasn't been done yet in this run
+func (ss *Sim) SetSlpThr(stoscs []StageOscs) {
+	switch {
+	case !ss.Slp.Calib.On:
+		ss.PlusThr, ss.MinusThr = ss.Slp.PlusThr, ss.Slp.MinusThr
+	case !ss.SlpCalibrated:
+		ss.CalibSlpThr(stoscs)
+	}
+}
+
+// CalibSlpThr runs the calibration segment of sleep (see CalibParams) and sets
+// PlusThr and MinusThr from it.  It uses its own random streams for the initial
+// activations and the noise, derived from the SlpCalib seed, and puts the network
+// back as it was afterward.
+func (ss *Sim) CalibSlpThr(stoscs []StageOscs) {
+	cp := &ss.Slp.Calib
+	ns := &NetState{}
+	ns.Get(ss.Net)
+	initRnd, noiseRnd := ss.SlpInitRnd, ss.SlpNoiseRnd
+	// separate streams for the activations and the noise, as in sleep, both from the SlpCalib seed
+	calSeed := ss.RunSeeds["SlpCalib"]
+	ss.SlpInitRnd = rand.New(rand.NewSource(DeriveSeed(calSeed, 0, "SlpInit")))
+	ss.SlpNoiseRnd = rand.New(rand.NewSource(DeriveSeed(calSeed, 0, "SlpNoise")))
+
+	ss.SlpCalib = true
+	ss.CalibSims = ss.CalibSims[:0]
+	ss.SleepCycInit()
+	ss.SlpCyc = 0
+	ss.SleepCyc(stoscs)
+
+	ss.SlpCalib = false
+	ss.SlpCyc = 0
+	ss.SynDepOn = false
+	ns.Set(ss.Net)
+	ss.SlpInitRnd, ss.SlpNoiseRnd = initRnd, noiseRnd
+
+	sims := append([]float64(nil), ss.CalibSims...)
+	sort.Float64s(sims)
+	ss.PlusThr = Percentile(sims, cp.PlusPct)
+	ss.MinusThr = Percentile(sims, cp.MinusPct)
+	ss.SlpCalibrated = true
+	fmt.Printf("Calibrated sleep thresholds: PlusThr: %s\tMinusThr: %s\n", FmtThr(ss.PlusThr), FmtThr(ss.MinusThr))
+	if !(ss.MinusThr < ss.PlusThr) {
+		fmt.Fprintf(os.Stderr, "calibrated MinusThr is not below PlusThr, so there will be no minus phases -- the AvgLaySim percentiles (Slp.Calib) are too close together\n")
+	}
+}
+
+// FmtThr formats a stability threshold at full precision -- they differ from 1
+// past the precision of the logs, so they are logged as strings
+func FmtThr(thr float64) string {
+	return strconv.FormatFloat(thr, 'g', -1, 64)
+}
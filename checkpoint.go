@@ -0,0 +1,508 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/emer/emergent/emer"
+	"github.com/emer/emergent/env"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/gi/gi"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// Checkpoint is the full state of the sim in the middle of training or sleep,
+// saved between training trials or sleep cycles.  Resuming from it continues the
+// run exactly as if it had never stopped: the network is rebuilt from the saved
+// config and run (which determine the random connectivity), and then all the
+// state that training and sleep depend on is restored on top of it.
+type Checkpoint struct {
+	Config   ExptConfig             `desc:"experiment config the sim was running with"`
+	LogSfx   string                 `desc:"suffix of the log file names (see NewBatchSim)"`
+	TrainEnv EnvState               `desc:"training env counters and order"`
+	TestEnv  EnvState               `desc:"testing env counters and order"`
+	Time     leabra.Time            `desc:"leabra timing state"`
+	Sim      SimState               `desc:"training stats, accumulators and sleep state of the sim"`
+	RndDraws map[string]int64       `desc:"number of values drawn from each of the private random streams, by name (see RndStreams)"`
+	Net      NetState               `desc:"network state, including weights, activations and synaptic depression"`
+	Logs     map[string]*TableState `desc:"contents of each log table, by log name (see LogTables)"`
+	LogOffs  map[string]int64       `desc:"size of each open log file, by log name, so that resuming can drop anything written after the checkpoint"`
+}
+
+// SimState are the fields of the Sim that hold the state of training and sleep,
+// as opposed to its settings -- they are copied by name to and from the Sim
+// (see CopyFields), so each must have the same name and type as on the Sim.
+type SimState struct {
+	TestNm        string
+	TrlSSE        float64
+	TrlAvgSSE     float64
+	TrlCosDiff    float64
+	EpcShSSE      float64
+	EpcShAvgSSE   float64
+	EpcShPctErr   float64
+	EpcShPctCor   float64
+	EpcShCosDiff  float64
+	ShFirstZero   int
+	ShNZero       int
+	EpcUnSSE      float64
+	EpcUnAvgSSE   float64
+	EpcUnPctErr   float64
+	EpcUnPctCor   float64
+	EpcUnCosDiff  float64
+	UnFirstZero   int
+	UnNZero       int
+	ShTrlNum      int
+	ShSumSSE      float64
+	ShSumAvgSSE   float64
+	ShSumCosDiff  float64
+	ShCntErr      int
+	UnTrlNum      int
+	UnSumSSE      float64
+	UnSumAvgSSE   float64
+	UnSumCosDiff  float64
+	UnCntErr      int
+	EpcCuSSE      float64
+	EpcCuPctCor   float64
+	EpcUcSSE      float64
+	EpcUcPctCor   float64
+	CuTrlNum      int
+	CuSumSSE      float64
+	CuCntErr      int
+	UcTrlNum      int
+	UcSumSSE      float64
+	UcCntErr      int
+	HiddenType    string
+	HiddenFeature string
+	ZError        int
+	NeedsNewRun   bool
+	DirSeed       int64
+	InhibFactor   float64
+	AvgLaySim     float64
+	PlusPhase     bool
+	MinusPhase    bool
+	SlpTrls       int
+	Sleeping      bool
+	SlpCyc        int
+	SlpBout       int
+	SchedSlp      bool
+	SchedSleeps   int
+	SchedTrls     int
+	PlusThr       float64
+	MinusThr      float64
+	SlpCalibrated bool
+	StabHist      ActHist
+	PlusActs      [][]float32
+	MinusActs     [][]float32
+	PhaseEvt      SlpPhaseEvt
+	BCMThr        map[string][]float32
+	PreSlpWts     []WtStats
+	SlpHomeoN     int
+	WtSnap        [][]float32
+	SlpNoiseN     int
+	RunNoiseN     int
+	PlusEvt       ReplayEvent
+	StableEvt     ReplayEvent
+	RippleEvt     ReplayEvent
+	RippleLeft    int
+	RippleN       int
+	PreShSSE      float64
+	PreShPctCor   float64
+	PreUnSSE      float64
+	PreUnPctCor   float64
+	PreCuSSE      float64
+	PreCuPctCor   float64
+	PreUcSSE      float64
+	PreUcPctCor   float64
+	CueItem       string
+	StableCnt     int
+	PlusCnt       int
+	MinusCnt      int
+	SlpWakeGi     map[string]float32
+	SlpStage      string
+	SlpUltCyc     int
+	SynDepOn      bool
+}
+
+// CopyFields sets each field of the struct pointed to by to from the field with
+// the same name in the struct pointed to by fm -- fm must have all the fields of to
+func CopyFields(to, fm interface{}) {
+	tv := reflect.ValueOf(to).Elem()
+	fv := reflect.ValueOf(fm).Elem()
+	for i := 0; i < tv.NumField(); i++ {
+		tv.Field(i).Set(fv.FieldByName(tv.Type().Field(i).Name))
+	}
+}
+
+// CopyFieldsFm sets each field of the struct pointed to by to that is also in the
+// struct pointed to by fm from its value there -- the other fields of to are left as is
+func CopyFieldsFm(to, fm interface{}) {
+	tv := reflect.ValueOf(to).Elem()
+	fv := reflect.ValueOf(fm).Elem()
+	for i := 0; i < fv.NumField(); i++ {
+		tv.FieldByName(fv.Type().Field(i).Name).Set(fv.Field(i))
+	}
+}
+
+// EnvState is the state of an env.FixedTable -- its counters and order
+type EnvState struct {
+	Order     []int
+	Run       env.Ctr
+	Epoch     env.Ctr
+	Trial     env.Ctr
+	TrialName env.CurPrvString
+	GroupName env.CurPrvString
+}
+
+// Get gets the state of the given env
+func (es *EnvState) Get(ev *env.FixedTable) {
+	es.Order = append([]int(nil), ev.Order...)
+	es.Run, es.Epoch, es.Trial = ev.Run, ev.Epoch, ev.Trial
+	es.TrialName, es.GroupName = ev.TrialName, ev.GroupName
+}
+
+// Set sets the state of the given env, which must already be initialized on the same table
+func (es *EnvState) Set(ev *env.FixedTable) {
+	ev.Order = append([]int(nil), es.Order...)
+	ev.Run, ev.Epoch, ev.Trial = es.Run, es.Epoch, es.Trial
+	ev.TrialName, ev.GroupName = es.TrialName, es.GroupName
+}
+
+// NetState is the state of the network that changes while running
+type NetState struct {
+	WtBalCtr int
+	Layers   []LayerState
+}
+
+// LayerState is the state of a layer and of its receiving projections.  Type and
+// Gi are included as sleep changes them.
+type LayerState struct {
+	Name    string
+	Type    emer.LayerType
+	Gi      float32
+	Sim     float64
+	CosDiff leabra.CosDiffStats
+	Neurons []leabra.Neuron
+	Pools   []leabra.Pool
+	Prjns   []PrjnState
+}
+
+// PrjnState is the state of a projection, including the synaptic depression
+// variables of its synapses (see InitSdEffWt).  WtScale is included as sleep
+// and AlphaCyc change it.
+type PrjnState struct {
+	Name    string
+	WtScale leabra.WtScaleParams
+	GScale  float32
+	Syns    []leabra.Synapse
+	GInc    []float32
+	WbRecv  []leabra.WtBalRecvPrjn
+}
+
+// Get gets the state of the given network
+func (ns *NetState) Get(net *leabra.Network) {
+	ns.WtBalCtr = net.WtBalCtr
+	ns.Layers = make([]LayerState, len(net.Layers))
+	for li, lyi := range net.Layers {
+		ly := lyi.(leabra.LeabraLayer).AsLeabra()
+		ls := &ns.Layers[li]
+		ls.Name = ly.Nm
+		ls.Type = ly.Typ
+		ls.Gi = ly.Inhib.Layer.Gi
+		ls.Sim = ly.Sim
+		ls.CosDiff = ly.CosDiff
+		ls.Neurons = append([]leabra.Neuron(nil), ly.Neurons...)
+		ls.Pools = append([]leabra.Pool(nil), ly.Pools...)
+		ls.Prjns = make([]PrjnState, len(ly.RcvPrjns))
+		for pi, pji := range ly.RcvPrjns {
+			pj := pji.(leabra.LeabraPrjn).AsLeabra()
+			ps := &ls.Prjns[pi]
+			ps.Name = pj.Name()
+			ps.WtScale = pj.WtScale
+			ps.GScale = pj.GScale
+			ps.Syns = append([]leabra.Synapse(nil), pj.Syns...)
+			ps.GInc = append([]float32(nil), pj.GInc...)
+			ps.WbRecv = append([]leabra.WtBalRecvPrjn(nil), pj.WbRecv...)
+		}
+	}
+}
+
+// Set sets the state of the given network, which must have been built the same
+// way as the one the state was saved from -- returns an error if it doesn't match
+func (ns *NetState) Set(net *leabra.Network) error {
+	if len(ns.Layers) != len(net.Layers) {
+		return fmt.Errorf("checkpoint has %d layers, network has %d", len(ns.Layers), len(net.Layers))
+	}
+	for li, lyi := range net.Layers {
+		ly := lyi.(leabra.LeabraLayer).AsLeabra()
+		ls := &ns.Layers[li]
+		if ls.Name != ly.Nm || len(ls.Neurons) != len(ly.Neurons) || len(ls.Pools) != len(ly.Pools) || len(ls.Prjns) != len(ly.RcvPrjns) {
+			return fmt.Errorf("checkpoint layer %s does not match network layer %s", ls.Name, ly.Nm)
+		}
+		for pi, pji := range ly.RcvPrjns {
+			pj := pji.(leabra.LeabraPrjn).AsLeabra()
+			ps := &ls.Prjns[pi]
+			if ps.Name != pj.Name() || len(ps.Syns) != len(pj.Syns) {
+				return fmt.Errorf("checkpoint prjn %s does not match network prjn %s -- check that the master seed and run match", ps.Name, pj.Name())
+			}
+		}
+	}
+	net.WtBalCtr = ns.WtBalCtr
+	for li, lyi := range net.Layers {
+		ly := lyi.(leabra.LeabraLayer).AsLeabra()
+		ls := &ns.Layers[li]
+		ly.Typ = ls.Type
+		ly.Inhib.Layer.Gi = ls.Gi
+		ly.Sim = ls.Sim
+		ly.CosDiff = ls.CosDiff
+		copy(ly.Neurons, ls.Neurons)
+		copy(ly.Pools, ls.Pools)
+		for pi, pji := range ly.RcvPrjns {
+			pj := pji.(leabra.LeabraPrjn).AsLeabra()
+			ps := &ls.Prjns[pi]
+			pj.WtScale = ps.WtScale
+			pj.GScale = ps.GScale
+			copy(pj.Syns, ps.Syns)
+			copy(pj.GInc, ps.GInc)
+			copy(pj.WbRecv, ps.WbRecv)
+		}
+	}
+	return nil
+}
+
+// TableState is the contents of a log table, by column name.  INT64 columns are
+// kept as is, so the seeds in the RunLog don't go through float64.
+type TableState struct {
+	Rows   int
+	Floats map[string][]float64
+	Ints   map[string][]int64
+	Strs   map[string][]string
+}
+
+// Get gets the contents of the given table
+func (ts *TableState) Get(dt *etable.Table) {
+	ts.Rows = dt.Rows
+	ts.Floats = make(map[string][]float64)
+	ts.Ints = make(map[string][]int64)
+	ts.Strs = make(map[string][]string)
+	for ci, col := range dt.Cols {
+		nm := dt.ColNames[ci]
+		switch tc := col.(type) {
+		case *etensor.Int64:
+			ts.Ints[nm] = append([]int64(nil), tc.Values...)
+		case *etensor.String:
+			ts.Strs[nm] = append([]string(nil), tc.Values...)
+		default:
+			vals := make([]float64, col.Len())
+			for i := range vals {
+				vals[i] = col.FloatVal1D(i)
+			}
+			ts.Floats[nm] = vals
+		}
+	}
+}
+
+// Set sets the contents of the given table, which must have the same columns
+func (ts *TableState) Set(dt *etable.Table) {
+	dt.SetNumRows(ts.Rows)
+	for ci, col := range dt.Cols {
+		nm := dt.ColNames[ci]
+		switch tc := col.(type) {
+		case *etensor.Int64:
+			copy(tc.Values, ts.Ints[nm])
+		case *etensor.String:
+			copy(tc.Values, ts.Strs[nm])
+		default:
+			for i, v := range ts.Floats[nm] {
+				if i < col.Len() {
+					col.SetFloat1D(i, v)
+				}
+			}
+		}
+	}
+}
+
+// Checkpoint returns a checkpoint of the current state of the sim
+func (ss *Sim) Checkpoint() *Checkpoint {
+	ck := &Checkpoint{Config: *ss.ExptConfig(), LogSfx: ss.LogSfx, Time: ss.Time}
+	ck.TrainEnv.Get(&ss.TrainEnv)
+	ck.TestEnv.Get(&ss.TestEnv)
+	CopyFields(&ck.Sim, ss)
+	ck.RndDraws = make(map[string]int64, len(ss.RndSrcs))
+	for nm, src := range ss.RndSrcs {
+		ck.RndDraws[nm] = src.Draws
+	}
+	ck.Net.Get(ss.Net)
+	ck.Logs = make(map[string]*TableState)
+	for lnm, dt := range ss.LogTables() {
+		ts := &TableState{}
+		ts.Get(dt)
+		ck.Logs[lnm] = ts
+	}
+	ck.LogOffs = make(map[string]int64)
+	for lnm, fp := range ss.LogFileSlots() {
+		if *fp == nil {
+			continue
+		}
+		if fi, err := (*fp).Stat(); err == nil {
+			ck.LogOffs[lnm] = fi.Size()
+		}
+	}
+	return ck
+}
+
+// RestoreCheckpoint sets the state of the sim from the given checkpoint.  The sim
+// must already be configured with the checkpoint's config (see OpenCheckpoint).
+// The network is first set up for the checkpoint's run with NewRun, which rebuilds
+// its random connectivity and random streams from the master seed.  Log files
+// opened afterward continue from where they were at the checkpoint (see OpenLogFile).
+func (ss *Sim) RestoreCheckpoint(ck *Checkpoint) error {
+	ss.LogSfx = ck.LogSfx
+	ss.TrainEnv.Run.Cur = ck.TrainEnv.Run.Cur
+	ss.NewRun()
+	if err := ck.Net.Set(ss.Net); err != nil {
+		return err
+	}
+	ck.TrainEnv.Set(&ss.TrainEnv)
+	ck.TestEnv.Set(&ss.TestEnv)
+	ss.Time = ck.Time
+	CopyFieldsFm(ss, &ck.Sim)
+	for nm, n := range ck.RndDraws {
+		if src, ok := ss.RndSrcs[nm]; ok {
+			src.Skip(n)
+		}
+	}
+	lts := ss.LogTables()
+	for lnm, ts := range ck.Logs {
+		if dt, ok := lts[lnm]; ok {
+			ts.Set(dt)
+		}
+	}
+	ss.LogOffs = ck.LogOffs
+	return nil
+}
+
+// CopyResumeLogs copies the log files of the checkpoint that was just restored,
+// up to where they were at the checkpoint, from the given directory (where the
+// checkpoint was saved) to the output directory, so that resuming continues them
+// there and leaves the originals as is, e.g., when branching off from a checkpoint.
+// Logs that can't be copied are started over.
+func (ss *Sim) CopyResumeLogs(fmdir string) {
+	for lnm, off := range ss.LogOffs {
+		dst := ss.LogFileName(lnm)
+		src := filepath.Join(fmdir, filepath.Base(dst))
+		sa, _ := filepath.Abs(src)
+		da, _ := filepath.Abs(dst)
+		if sa == da { // resuming in place
+			continue
+		}
+		if err := CopyFileN(dst, src, off); err != nil {
+			log.Println(err)
+			delete(ss.LogOffs, lnm)
+		}
+	}
+}
+
+// CopyFileN copies the first n bytes of file src to file dst
+func CopyFileN(dst, src string, n int64) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.CopyN(df, sf, n); err != nil {
+		err = fmt.Errorf("%s: %v", src, err)
+	}
+	if cerr := df.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// SaveCheckpoint saves a checkpoint of the current state of the sim to the given
+// file (gzipped gob), which OpenCheckpoint can resume from.  The file is written
+// in full before it replaces any existing file, so a checkpoint is never left
+// half-written if the process is killed.
+func (ss *Sim) SaveCheckpoint(filename gi.FileName) error {
+	fnm := string(filename)
+	tmp := fnm + ".tmp"
+	fp, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(fp)
+	err = gob.NewEncoder(gz).Encode(ss.Checkpoint())
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, fnm)
+}
+
+// ReadCheckpoint reads a checkpoint saved by SaveCheckpoint from the given file
+func ReadCheckpoint(filename gi.FileName) (*Checkpoint, error) {
+	fp, err := os.Open(string(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	gz, err := gzip.NewReader(fp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	ck := &Checkpoint{}
+	if err := gob.NewDecoder(gz).Decode(ck); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return ck, nil
+}
+
+// OpenCheckpoint resumes from the checkpoint in the given file: it applies the
+// checkpoint's config, re-initializes the sim, and restores the checkpoint's state.
+// Train then continues the run from where the checkpoint was saved.
+func (ss *Sim) OpenCheckpoint(filename gi.FileName) error {
+	ck, err := ReadCheckpoint(filename)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	ss.ApplyExptConfig(&ck.Config)
+	ss.Init()
+	if err := ss.RestoreCheckpoint(ck); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// CheckpointFileName returns the name of the file that AutoCheckpoint saves to
+func (ss *Sim) CheckpointFileName() string {
+	return ss.OutFile(ss.Net.Nm + "_" + ss.RunName() + ss.LogSfx + ".ckpt")
+}
+
+// AutoCheckpoint saves a checkpoint to CheckpointFileName -- called during
+// training every CkptEpcs epochs and every CkptSlpCycs cycles of sleep
+func (ss *Sim) AutoCheckpoint() {
+	fnm := ss.CheckpointFileName()
+	if err := ss.SaveCheckpoint(gi.FileName(fnm)); err != nil {
+		log.Println(err)
+		return
+	}
+	fmt.Printf("Saved checkpoint to: %v  Run: %d  Epoch: %d  Sleep cycle: %d\n", fnm, ss.TrainEnv.Run.Cur, ss.TrainEnv.Epoch.Cur, ss.SlpCyc)
+}
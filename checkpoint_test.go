@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/goki/gi/gi"
+)
+
+// NotSimState are the fields of the Sim that aren't in SimState, and why.  Every
+// field of the Sim must be in one or the other (see TestSimStateCoverage), so
+// that new state can't be left out of the checkpoints by mistake.
+var NotSimState = map[string]string{
+	// settings -- those of ExptConfig are in Checkpoint.Config, and the rest are
+	// set by the GUI or command line
+	"Params": "settings", "ParamSet": "settings", "Tag": "settings", "MaxRuns": "settings",
+	"MaxEpcs": "settings", "NZeroStop": "settings", "TrialPerEpc": "settings",
+	"TestInterval": "settings", "Task": "settings", "Sleep": "settings", "LrnDrgSlp": "settings",
+	"Slp": "settings", "Sched": "settings", "InhibOscil": "settings", "SynDep": "settings",
+	"SlpLearn": "settings", "ExecSleep": "settings", "SaveWts": "settings",
+	"NoGui": "settings", "LogSetParams": "settings", "RndSeed": "settings", "OutDir": "settings",
+	"LogSfx": "settings", "CkptEpcs": "settings", "CkptSlpCycs": "settings", "ViewOn": "settings",
+	"TrainUpdt": "settings", "TestUpdt": "settings", "SleepUpdt": "settings",
+
+	// restored on their own by RestoreCheckpoint
+	"Net": "restored", "TrainEnv": "restored", "TestEnv": "restored", "Time": "restored",
+	"RndSrcs": "restored", "LogOffs": "restored", "RunSeeds": "restored by NewRun",
+	"TrainRnd": "restored by RndSrcs", "SlpInitRnd": "restored by RndSrcs",
+	"SlpNoiseRnd": "restored by RndSrcs", "EnvOrderRnd": "restored by RndSrcs",
+	"TrnTrlLog": "restored log", "TrnEpcLog": "restored log", "TstEpcLog": "restored log",
+	"TstTrlLog": "restored log", "TstCycLog": "restored log", "RunLog": "restored log",
+	"SlpCycLog": "restored log", "ReplayLog": "restored log", "SlpWtLog": "restored log",
+	"SlpPhaseLog": "restored log", "PrjnWtLog": "restored log",
+
+	// set up from the config by Config and Init
+	"TrainSat": "config", "TestSat": "config", "SleepEnv": "config", "RunStats": "config",
+	"TstStats": "config", "TmpVals": "config", "LayStatNms": "config", "TstNms": "config",
+
+	// set up again by SleepTrial when a sleep trial resumes
+	"SlpSynDeps": "sleep trial", "SlpPlasts": "sleep trial", "ReplayDecItems": "sleep trial",
+	"CuePats": "sleep trial", "CueClampHard": "sleep trial", "OscVals": "sleep trial",
+
+	// set at each cycle of sleep before they are used
+	"LaySims": "sleep cycle", "LayContribs": "sleep cycle", "LayNaN": "sleep cycle",
+	"SlpNoiseNrns": "sleep cycle", "PrjnDep": "sleep cycle",
+
+	// only used within CalibSlpThr, which is never checkpointed partway
+	"SlpCalib": "calibration", "CalibSims": "calibration",
+
+	// GUI, run control and open files
+	"Win": "gui", "NetView": "gui", "ToolBar": "gui", "TrnTrlPlot": "gui", "TrnEpcPlot": "gui",
+	"TstEpcPlot": "gui", "TstTrlPlot": "gui", "TstCycPlot": "gui", "RunPlot": "gui",
+	"PrjnWtPlot": "gui", "SlpCycPlot": "gui", "IsRunning": "control", "StopNow": "control",
+	"Interrupted": "control", "BatchSims": "control",
+	"TrnTrlFile": "file", "TrnEpcFile": "file", "TstTrlFile": "file", "TstEpcFile": "file",
+	"TstCycFile": "file", "SlpCycFile": "file", "ReplayFile": "file", "SlpWtFile": "file",
+	"SlpPhaseFile": "file", "PrjnWtFile": "file", "RunFile": "file",
+}
+
+func TestSimStateFields(t *testing.T) {
+	st := reflect.TypeOf(SimState{})
+	simt := reflect.TypeOf(Sim{})
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		f, has := simt.FieldByName(sf.Name)
+		switch {
+		case !has:
+			t.Errorf("SimState.%s is not a field of Sim", sf.Name)
+		case f.Type != sf.Type:
+			t.Errorf("SimState.%s is a %v, Sim.%s is a %v", sf.Name, sf.Type, sf.Name, f.Type)
+		}
+		if _, has := NotSimState[sf.Name]; has {
+			t.Errorf("SimState.%s is also in NotSimState", sf.Name)
+		}
+	}
+}
+
+func TestSimStateCoverage(t *testing.T) {
+	st := reflect.TypeOf(SimState{})
+	simt := reflect.TypeOf(Sim{})
+	for i := 0; i < simt.NumField(); i++ {
+		nm := simt.Field(i).Name
+		if _, has := st.FieldByName(nm); has {
+			continue
+		}
+		if _, has := NotSimState[nm]; !has {
+			t.Errorf("Sim.%s is in neither SimState nor NotSimState -- add it to SimState if it is state that training or sleep depend on", nm)
+		}
+	}
+	for nm := range NotSimState {
+		if _, has := simt.FieldByName(nm); !has {
+			t.Errorf("NotSimState has %s, which is not a field of Sim", nm)
+		}
+	}
+}
+
+// DiffVals returns a description of the first difference between a and b, which
+// are compared field by field, with NaNs equal to each other -- "" if none.
+// Unexported fields are skipped, as gob doesn't save them.
+func DiffVals(a, b reflect.Value, path string) string {
+	if a.Kind() != b.Kind() {
+		return fmt.Sprintf("%s: %v vs %v", path, a.Kind(), b.Kind())
+	}
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				return path + ": nil vs not nil"
+			}
+			return ""
+		}
+		return DiffVals(a.Elem(), b.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if a.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if d := DiffVals(a.Field(i), b.Field(i), path+"."+a.Type().Field(i).Name); d != "" {
+				return d
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return fmt.Sprintf("%s: len %d vs %d", path, a.Len(), b.Len())
+		}
+		for i := 0; i < a.Len(); i++ {
+			if d := DiffVals(a.Index(i), b.Index(i), fmt.Sprintf("%s[%d]", path, i)); d != "" {
+				return d
+			}
+		}
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return fmt.Sprintf("%s: len %d vs %d", path, a.Len(), b.Len())
+		}
+		for _, k := range a.MapKeys() {
+			bv := b.MapIndex(k)
+			if !bv.IsValid() {
+				return fmt.Sprintf("%s[%v]: missing", path, k)
+			}
+			if d := DiffVals(a.MapIndex(k), bv, fmt.Sprintf("%s[%v]", path, k)); d != "" {
+				return d
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		af, bf := a.Float(), b.Float()
+		if af != bf && !(math.IsNaN(af) && math.IsNaN(bf)) {
+			return fmt.Sprintf("%s: %v vs %v", path, af, bf)
+		}
+	default:
+		if a.Interface() != b.Interface() {
+			return fmt.Sprintf("%s: %v vs %v", path, a.Interface(), b.Interface())
+		}
+	}
+	return ""
+}
+
+// TestCheckpointRoundTrip saves a checkpoint partway through a sleep trial, resumes
+// a new sim from it and saves that again -- the two checkpoints must be the same.
+// They are compared field by field rather than byte by byte, as gob encodes maps
+// in random order.
+func TestCheckpointRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ckpt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ss := newTestSim(t, 3)
+	ss.Slp.Cycles = 200
+	ss.Slp.Ripple.On = true
+	ss.Slp.Cue.Items = []string{ss.TrainSat.CellString("Name", 0)}
+	ss.Slp.Cue.Start = 0
+	ss.Slp.Homeo.On = true
+	ss.Slp.Homeo.Period = 10
+	for i := 0; i < 5; i++ {
+		ss.TrainTrial()
+	}
+	for ss.SlpCyc < 120 { // stops after each cycle
+		ss.StopNow = true
+		ss.SleepTrial()
+	}
+	if !ss.Sleeping || ss.RippleN == 0 {
+		t.Fatalf("Sleeping = %v and RippleN = %d at cycle %d, want a sleep trial underway with ripples", ss.Sleeping, ss.RippleN, ss.SlpCyc)
+	}
+
+	fnm1 := filepath.Join(dir, "ck1.ckpt")
+	fnm2 := filepath.Join(dir, "ck2.ckpt")
+	if err := ss.SaveCheckpoint(gi.FileName(fnm1)); err != nil {
+		t.Fatal(err)
+	}
+	rs := &Sim{}
+	rs.New()
+	rs.NoGui = true
+	rs.ViewOn = false
+	rs.Config()
+	if err := rs.OpenCheckpoint(gi.FileName(fnm1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.SaveCheckpoint(gi.FileName(fnm2)); err != nil {
+		t.Fatal(err)
+	}
+	ck1, err := ReadCheckpoint(gi.FileName(fnm1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ck2, err := ReadCheckpoint(gi.FileName(fnm2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := DiffVals(reflect.ValueOf(ck1), reflect.ValueOf(ck2), "Checkpoint"); d != "" {
+		t.Errorf("checkpoint changed by resuming from it: %s", d)
+	}
+
+	// the resumed sim goes on exactly as the original does
+	ss.StopNow = false
+	ss.SleepTrial()
+	rs.StopNow = false
+	rs.SleepTrial()
+	for _, lnm := range []string{"slpcyc", "replay", "slpphase", "slpwt", "prjnwt"} {
+		t1, t2 := &TableState{}, &TableState{}
+		t1.Get(ss.LogTables()[lnm])
+		t2.Get(rs.LogTables()[lnm])
+		if d := DiffVals(reflect.ValueOf(t1), reflect.ValueOf(t2), lnm); d != "" {
+			t.Errorf("resumed sleep differs: %s", d)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emer/etable/etable"
+	"github.com/goki/gi/gi"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// CmdNms are the subcommands that can be given as the first command-line arg
+var CmdNms = []string{"train", "sleep", "test", "inspect", "sweep"}
+
+// LogNms are the short names of the logs that can be streamed to file, in the
+// order their -<name>log flags are listed (see LogFileSlots)
+var LogNms = []string{"trntrl", "epc", "tsttrl", "tstepc", "tstcyc", "slpcyc", "replay", "slpwt", "slpphase", "prjnwt", "run"}
+
+// CmdArgs runs the sim from the command line, without the gui:
+//
+//	slp-rep [train | sleep | test | inspect | sweep] [flags]
+//
+// train trains to criterion and saves the trained weights, sleep runs only
+// SleepTrial on the weights given by -weights, test runs TestAll on the weights
+// given by -weights, inspect prints the network structure and params, and sweep
+// trains and sleeps several seeds at each point of the sweep given by -spec.
+// With only flags and no subcommand, the full train -> sleep -> test cycle is run
+// for every run, as before.  Use slp-rep <cmd> -h for the flags of each command.
+// SIGINT or SIGTERM stops the command after the current trial or sleep cycle,
+// saves everything, and exits with status ExitInterrupted (see HandleSignals).
+// An experiment config file given by -config is applied first, and any flags
+// given explicitly override it.  The resolved config is saved with the outputs.
+// Training can save checkpoints (-ckpt, -slpckpt) and -resume continues from one,
+// with the checkpoint's config applied before -config and the flags.
+func (ss *Sim) CmdArgs() {
+	ss.NoGui = true
+	cmd := ""
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd = args[0]
+		args = args[1:]
+	}
+	switch cmd {
+	case "", "train", "sleep", "test", "inspect", "sweep":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s -- must be one of: %s\n", cmd, strings.Join(CmdNms, ", "))
+		os.Exit(2)
+	}
+
+	var seed int64
+	var run int
+	var cfgFile string
+	var wtsFile string
+	var outFile string
+	var procs int
+	var resume string
+	var specFile string
+	var outBase string
+	var logs map[string]*bool
+	fs := flag.NewFlagSet("slp-rep "+cmd, flag.ExitOnError)
+	fs.StringVar(&cfgFile, "config", "", "experiment config JSON file to load -- flags given explicitly override its values")
+	fs.StringVar(&ss.ParamSet, "params", "", "ParamSet name to use -- must be valid name as listed in compiled-in params or loaded params")
+	fs.StringVar(&ss.Tag, "tag", "", "extra tag to add to file names saved from this run")
+	fs.Int64Var(&seed, "seed", 0, "master random seed that all per-run seeds are derived from -- 0 = new seed based on the time")
+	fs.IntVar(&run, "run", 0, "run number to start at -- together with -seed this determines the derived seeds, and thus the DG / CA3 connectivity, so use the same values as training when loading weights")
+	fs.BoolVar(&ss.LogSetParams, "setparams", false, "if true, print a record of each parameter that is set")
+	if cmd != "inspect" {
+		fs.StringVar(&outBase, "outdir", "results", "directory to create the timestamped output directory of this command in, which gets all its logs, weights and reports along with a manifest.json -- empty = save them in the current directory")
+	}
+	switch cmd {
+	case "", "train":
+		fs.IntVar(&ss.MaxRuns, "runs", 30, "number of runs to do (note that MaxEpcs is in paramset)")
+		fs.BoolVar(&ss.SaveWts, "wts", cmd == "train", "if true, save final weights after each run")
+		if cmd == "train" {
+			fs.BoolVar(&ss.ExecSleep, "sleep", false, "if true, sleep and test again once criterion is reached (or as scheduled by Sched in the config), so the saved weights are post-sleep")
+		}
+		fs.Bool("nogui", true, "runs without the gui, as always from the command line -- only there to give an arg when there are no others")
+		fs.IntVar(&procs, "procs", 1, "number of runs to do at the same time, each on its own copy of the sim -- 0 = one per CPU core.  Logs other than the run log are then saved per run.")
+		fs.IntVar(&ss.CkptEpcs, "ckpt", 0, "save a checkpoint at the end of every this many training epochs -- 0 = never")
+		fs.IntVar(&ss.CkptSlpCycs, "slpckpt", 0, "save a checkpoint every this many cycles of sleep -- 0 = never")
+		fs.StringVar(&resume, "resume", "", "checkpoint file to resume training from -- the run continues exactly where the checkpoint was saved, appending to its log files")
+		logs = ss.LogFlags(fs, "epc", "tstepc", "slpcyc", "replay", "slpwt", "slpphase", "prjnwt", "run")
+	case "sleep":
+		fs.StringVar(&wtsFile, "weights", "", "weights file to load before sleeping (required)")
+		fs.StringVar(&outFile, "out", "", "file to save the post-sleep weights to -- defaults to the -weights name with _slp added, in the output directory")
+		logs = ss.LogFlags(fs, "slpcyc", "replay", "slpwt", "slpphase", "prjnwt")
+	case "test":
+		fs.StringVar(&wtsFile, "weights", "", "weights file to load before testing (required)")
+		logs = ss.LogFlags(fs, "tsttrl", "tstepc")
+	case "sweep":
+		fs.StringVar(&specFile, "spec", "", "sweep spec JSON file, with the params to sweep and the seeds per point (required)")
+		fs.IntVar(&procs, "procs", 0, "number of runs to do at the same time, each on its own copy of the sim -- 0 = one per CPU core")
+		logs = ss.LogFlags(fs)
+	}
+	fs.Parse(args)
+	if (cmd == "sleep" || cmd == "test") && wtsFile == "" {
+		fmt.Fprintf(os.Stderr, "slp-rep %s: -weights file is required\n", cmd)
+		os.Exit(2)
+	}
+	if cmd == "sweep" && specFile == "" {
+		fmt.Fprintf(os.Stderr, "slp-rep %s: -spec file is required\n", cmd)
+		os.Exit(2)
+	}
+	if resume != "" && (seed != 0 || run != 0 || procs != 1) {
+		fmt.Fprintf(os.Stderr, "slp-rep %s: -resume continues the seed and run of the checkpoint, and cannot be used with -seed, -run or -procs\n", cmd)
+		os.Exit(2)
+	}
+
+	var ckpt *Checkpoint
+	if resume != "" {
+		var err error
+		if ckpt, err = ReadCheckpoint(gi.FileName(resume)); err != nil {
+			fmt.Fprintf(os.Stderr, "slp-rep %s: %v\n", cmd, err)
+			os.Exit(2)
+		}
+		ss.ApplyExptConfig(&ckpt.Config)
+	}
+	if cfgFile != "" {
+		if err := ss.OpenExptConfig(gi.FileName(cfgFile)); err != nil {
+			fmt.Fprintf(os.Stderr, "slp-rep %s: %v\n", cmd, err)
+			os.Exit(2)
+		}
+		fmt.Printf("Loaded config from: %s\n", cfgFile)
+	}
+	if ckpt != nil || cfgFile != "" {
+		fs.Visit(func(f *flag.Flag) { // explicit flags take precedence over the config
+			fs.Set(f.Name, f.Value.String())
+		})
+	}
+	if seed != 0 {
+		ss.RndSeed = seed
+	}
+	if err := ss.ExptConfig().Validate(ss); err != nil {
+		fmt.Fprintf(os.Stderr, "slp-rep %s: invalid config:\n  %v\n", cmd, err)
+		os.Exit(2)
+	}
+	ss.Init()
+	if ckpt != nil {
+		if err := ss.RestoreCheckpoint(ckpt); err != nil {
+			fmt.Fprintf(os.Stderr, "slp-rep %s: could not resume from %s: %v\n", cmd, resume, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Resuming from checkpoint: %s  Epoch: %d  Sleep cycle: %d\n", resume, ss.TrainEnv.Epoch.Cur, ss.SlpCyc)
+	} else if run != 0 {
+		ss.TrainEnv.Run.Cur = run
+		ss.NewRun()
+	}
+
+	var spec *SweepSpec
+	if specFile != "" {
+		var err error
+		if spec, err = ss.OpenSweepSpec(gi.FileName(specFile)); err != nil {
+			fmt.Fprintf(os.Stderr, "slp-rep %s: %v\n", cmd, err)
+			os.Exit(2)
+		}
+	}
+
+	if ss.ParamSet != "" {
+		fmt.Printf("Using ParamSet: %s\n", ss.ParamSet)
+	}
+	fmt.Printf("Master seed: %d  Run: %d\n", ss.RndSeed, ss.TrainEnv.Run.Cur)
+
+	if wtsFile != "" {
+		if err := ss.OpenWeights(gi.FileName(wtsFile)); err != nil {
+			fmt.Fprintf(os.Stderr, "slp-rep %s: could not load weights from %s -- check that -seed and -run match the training run\n", cmd, wtsFile)
+			os.Exit(1)
+		}
+		fmt.Printf("Loaded weights from: %s\n", wtsFile)
+	}
+
+	if cmd != "inspect" {
+		if outBase != "" {
+			if err := ss.NewOutDir(outBase); err != nil {
+				fmt.Fprintf(os.Stderr, "slp-rep %s: could not create output directory: %v\n", cmd, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Saving outputs to: %s\n", ss.OutDir)
+		}
+		if ckpt != nil {
+			ss.CopyResumeLogs(filepath.Dir(resume))
+		}
+		lastRun := ss.TrainEnv.Run.Cur + 1
+		switch cmd {
+		case "", "train":
+			lastRun = ss.MaxRuns
+		case "sweep":
+			lastRun = ss.TrainEnv.Run.Cur + spec.Seeds
+		}
+		mf := ss.Manifest(cmd, fs, lastRun, []string{cfgFile, wtsFile, specFile, resume})
+		if err := mf.SaveManifest(gi.FileName(ss.ManifestFileName())); err != nil {
+			fmt.Fprintf(os.Stderr, "slp-rep %s: could not save manifest: %v\n", cmd, err)
+		}
+		fnm := ss.ExptConfigFileName()
+		fmt.Printf("Saving config to: %s\n", fnm)
+		if err := ss.SaveExptConfig(gi.FileName(fnm)); err != nil {
+			fmt.Fprintf(os.Stderr, "slp-rep %s: could not save config: %v\n", cmd, err)
+		}
+	}
+
+	var lognms []string
+	for _, lnm := range LogNms {
+		if on, ok := logs[lnm]; ok && *on {
+			lognms = append(lognms, lnm)
+		}
+	}
+	ss.HandleSignals()
+	switch {
+	case procs != 1 && (cmd == "" || cmd == "train"):
+		ss.CmdBatch(procs, lognms)
+	case cmd == "sweep":
+		ss.CmdSweep(spec, procs, lognms)
+	default:
+		ss.OpenLogFiles(lognms)
+		switch cmd {
+		case "", "train":
+			ss.CmdTrain()
+		case "sleep":
+			ss.CmdSleep(wtsFile, outFile)
+		case "test":
+			ss.CmdTest()
+		case "inspect":
+			ss.CmdInspect()
+		}
+		if ss.IsInterrupted() {
+			ss.SaveInterrupted(cmd == "" || cmd == "train")
+		}
+		ss.CloseLogFiles()
+	}
+	if ss.IsInterrupted() {
+		fmt.Fprintf(os.Stderr, "slp-rep %s: interrupted -- exiting with status %d\n", cmd, ExitInterrupted)
+		os.Exit(ExitInterrupted)
+	}
+}
+
+// LogFlags adds a -<name>log flag to the flag set for each of the LogNms,
+// which are on by default if listed in on.  Returns the flag values by log name.
+func (ss *Sim) LogFlags(fs *flag.FlagSet, on ...string) map[string]*bool {
+	logs := make(map[string]*bool, len(LogNms))
+	for _, lnm := range LogNms {
+		def := false
+		for _, o := range on {
+			if o == lnm {
+				def = true
+			}
+		}
+		logs[lnm] = fs.Bool(lnm+"log", def, "if true, save "+lnm+" log to file")
+	}
+	return logs
+}
+
+// CmdTrain trains for MaxRuns runs, each to criterion (and through sleep if ExecSleep)
+func (ss *Sim) CmdTrain() {
+	if ss.SaveWts {
+		fmt.Printf("Saving final weights per run\n")
+	}
+	fmt.Printf("Running %d Runs\n", ss.MaxRuns-ss.TrainEnv.Run.Cur)
+	ss.Train()
+}
+
+// CmdBatch does the runs of CmdTrain with up to procs of them at the same time
+// (see RunBatch).  This sim only writes the merged run log -- the other logs are
+// written by the sim of each run, to files with the run number in their names.
+func (ss *Sim) CmdBatch(procs int, lognms []string) {
+	var runlog []string
+	var perrun []string
+	for _, lnm := range lognms {
+		if lnm == "run" {
+			runlog = append(runlog, lnm)
+		} else {
+			perrun = append(perrun, lnm)
+		}
+	}
+	ss.OpenLogFiles(runlog)
+	defer ss.CloseLogFiles()
+	if ss.SaveWts {
+		fmt.Printf("Saving final weights per run\n")
+	}
+	ss.RunBatch(procs, perrun)
+}
+
+// CmdSweep runs the sweep (see RunSweep) and saves the SweepLog, along with a copy
+// of the spec, next to the config
+func (ss *Sim) CmdSweep(spec *SweepSpec, procs int, lognms []string) {
+	swl := ss.RunSweep(spec, procs, lognms)
+	fnm := ss.SweepLogFileName()
+	fmt.Printf("Saving sweep results to: %s\n", fnm)
+	if err := swl.SaveCSV(gi.FileName(fnm), etable.Tab, etable.Headers); err != nil {
+		fmt.Fprintf(os.Stderr, "slp-rep sweep: could not save results: %v\n", err)
+	}
+	b, _ := json.MarshalIndent(spec, "", "  ")
+	sfnm := strings.TrimSuffix(fnm, ".tsv") + ".json"
+	if err := ioutil.WriteFile(sfnm, append(b, '\n'), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "slp-rep sweep: could not save spec: %v\n", err)
+	}
+}
+
+// CmdSleep runs one SleepTrial on the loaded weights, and saves the post-sleep weights
+func (ss *Sim) CmdSleep(wtsFile, outFile string) {
+	if outFile == "" {
+		base := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(wtsFile), ".gz"), ".wts")
+		outFile = ss.OutFile(base + "_slp.wts")
+		if strings.HasSuffix(wtsFile, ".gz") {
+			outFile += ".gz"
+		}
+	}
+	ss.SleepTrial()
+	if ss.IsInterrupted() { // not done sleeping
+		return
+	}
+	fmt.Printf("Saving Weights to: %v\n", outFile)
+	ss.SaveWeights(gi.FileName(outFile))
+}
+
+// CmdTest runs TestAll on the loaded weights and reports the summary stats
+func (ss *Sim) CmdTest() {
+	ss.TestAll()
+	fmt.Println("Shared Pct Correct:", ss.EpcShPctCor)
+	fmt.Println("Unique Pct Correct:", ss.EpcUnPctCor)
+	fmt.Println("Shared SSE:", ss.EpcShSSE)
+	fmt.Println("Unique SSE:", ss.EpcUnSSE)
+}
+
+// CmdInspect prints the network structure (layers and their receiving projections)
+// followed by the full set of parameters in effect
+func (ss *Sim) CmdInspect() {
+	fmt.Printf("Network: %s  ParamSet: %s\n\n", ss.Net.Nm, ss.ParamsName())
+	for _, lyi := range ss.Net.Layers {
+		ly := lyi.(leabra.LeabraLayer).AsLeabra()
+		fmt.Printf("Layer: %-10s %-8s shape: %v  class: %s  Gi: %g\n", ly.Nm, ly.Typ, ly.Shp.Shp, ly.Cls, ly.Inhib.Layer.Gi)
+		for _, pji := range ly.RcvPrjns {
+			pj := pji.(leabra.LeabraPrjn).AsLeabra()
+			fmt.Printf("    %-22s %-8s %-8s class: %-11s syns: %d\n", pj.Name(), pj.Typ, pj.Pattern().Name(), pj.Cls, len(pj.Syns))
+		}
+	}
+	fmt.Printf("\n%s", ss.Net.AllParams())
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/goki/gi/gi"
+)
+
+// TaskParams are the settings of the satellite learning task and of the
+// criterion that ends wake training
+type TaskParams struct {
+	TrainPats    string  `def:"Train_Sats_go.txt" desc:"tab-separated file with the training patterns"`
+	TestPats     string  `def:"Test_Sats_go.txt" desc:"tab-separated file with the testing patterns"`
+	CritShPctCor float64 `def:"0.8" min:"0" max:"1" desc:"test pct correct on shared features needed to reach criterion -- training stops (and sleep starts) when both criteria are met"`
+	CritUnPctCor float64 `def:"0.8" min:"0" max:"1" desc:"test pct correct on unique features needed to reach criterion"`
+	SharedHideP  float64 `def:"0.05" min:"0" max:"1" desc:"probability that a training trial hides a shared feature instead of a unique one"`
+	CodeHideP    float64 `def:"0.5" min:"0" max:"1" desc:"probability that a unique-feature trial hides the CodeName instead of the unique feature itself (always CodeName if there is no unique feature)"`
+}
+
+// Defaults sets the default task params
+func (tp *TaskParams) Defaults() {
+	tp.TrainPats = "Train_Sats_go.txt"
+	tp.TestPats = "Test_Sats_go.txt"
+	tp.CritShPctCor = 0.8
+	tp.CritUnPctCor = 0.8
+	tp.SharedHideP = 0.05
+	tp.CodeHideP = 0.5
+}
+
+// SleepParams are the settings of a sleep trial: its length, the inhibitory
+// oscillations, synaptic depression, and the stability thresholds that mark
+// the sleep plus and minus phases
+type SleepParams struct {
+	Cycles      int              `def:"30000" min:"1" desc:"number of cycles in a sleep trial (bout) -- the oscillations and the SlpCycLog follow it"`
+	Bouts       int              `def:"1" min:"1" desc:"number of sleep bouts once training reaches criterion, each followed by a test of all the patterns"`
+	WtLogCycs   int              `def:"1000" min:"0" desc:"number of cycles of sleep between the rows of the PrjnWtLog, which also has one at the end of each sleep trial and after each training epoch -- 0 = only at the end"`
+	OscGroups   OscGroups        `desc:"groups of layers that get their own inhibitory oscillation, as a multiplier on each layer's Gi -- by default, a low amplitude group (ClassName, CA1, CodeName) and a high amplitude one (F1-F5, DG, CA3)"`
+	SynDepModel string           `def:"ca" desc:"model of synaptic depression: ca = Ca-based, driven by sender-receiver co-activity; tm = Tsodyks-Markram style depletion of the synaptic resources, driven by sender activity"`
+	SynDepInc   float32          `def:"0.0007" desc:"rate at which synaptic depression increases at each active synapse -- the default for every prjn, which the SynDep params sheet can set for each layer or prjn (see SynDepParams)"`
+	SynDepDec   float32          `def:"0.0005" desc:"rate at which synaptic depression recovers at each synapse -- the default for every prjn, as with SynDepInc"`
+	CA3RecAbs   float32          `def:"2" desc:"WtScale.Abs of CA3 -> CA3 during sleep"`
+	CA1PerAbs   float32          `def:"2" desc:"WtScale.Abs of CA1 -> perceptual layers during sleep -- higher leads to better replays"`
+	PlusThr     float64          `def:"0.9999993129" desc:"AvgLaySim needed to start (and stay in) a plus phase -- unless it is calibrated (see Calib)"`
+	MinusThr    float64          `def:"0.9989938129" desc:"AvgLaySim below which a minus phase ends -- unless it is calibrated (see Calib)"`
+	StableCycs  int              `def:"5" min:"1" desc:"number of cycles AvgLaySim must stay above PlusThr before a plus phase starts"`
+	Stability   StabilityParams  `desc:"metric of the stability of the network (AvgLaySim) that drives the plus and minus phases -- by default, the mean Sim of all the layers"`
+	Calib       CalibParams      `desc:"calibration of PlusThr and MinusThr from the AvgLaySim of a short segment of sleep without learning, for networks they weren't tuned for"`
+	Noise       NoiseParams      `desc:"noise injected into the activations during sleep -- by default, uniform noise in all layers when AvgLaySim falls too low"`
+	Replay      ReplayParams     `desc:"decoding of the replay events during sleep (plus phases, and optionally stable periods) into the training items they best match, in the ReplayLog"`
+	Homeo       HomeoParams      `desc:"synaptic homeostasis: periodic global downscaling of the weights during sleep, alongside or instead of the plus and minus phase learning"`
+	Plasticity  PlasticityParams `desc:"learning rule of each prjn during sleep -- by default, the contrast of the plus and minus phases (chl)"`
+	Cue         CueParams        `desc:"targeted memory reactivation (TMR): cueing items during sleep with weak external input, e.g., their CodeName pattern -- the tests are split into the cued and uncued items"`
+	Ripple      RippleParams     `desc:"sharp-wave ripples: brief, high-gain CA3 recurrent bursts at a phase of an inhibitory oscillation, which are logged in the ReplayLog with what they replay"`
+	Stages      SleepStages      `desc:"stages of sleep (e.g., NREM2, SWS, REM), each with its own length, oscillations, syn dep, prjn scaling and learning, which repeat in order as ultradian cycles until the end of the trial -- if empty, the whole trial is one stage"`
+}
+
+// Defaults sets the default sleep params
+func (sp *SleepParams) Defaults() {
+	sp.Cycles = 30000
+	sp.Bouts = 1
+	sp.WtLogCycs = 1000
+	sp.OscGroups = OscGroups{
+		{Name: "Low", Osc: OscParams{Type: "sine", Freq: 0.1, Amp: 1.0 / 80, Offset: 0.99}, Layers: []string{"ClassName", "CA1", "CodeName"}},
+		{Name: "High", Osc: OscParams{Type: "sine", Freq: 0.1, Amp: 1.0 / 30, Offset: 0.99}, Layers: []string{"F1", "F2", "F3", "F4", "F5", "DG", "CA3"}},
+	}
+	sp.SynDepModel = "ca"
+	sp.SynDepInc = 0.0007
+	sp.SynDepDec = 0.0005
+	sp.CA3RecAbs = 2
+	sp.CA1PerAbs = 2
+	sp.PlusThr = 0.9999938129217251 + 0.0000055
+	sp.MinusThr = 0.9999938129217251 - 0.001
+	sp.StableCycs = 5
+	sp.Stability.Defaults()
+	sp.Calib.Defaults()
+	sp.Noise.Defaults()
+	sp.Replay.Defaults()
+	sp.Plasticity.Defaults()
+	sp.Homeo.Defaults()
+	sp.Cue.Defaults()
+	sp.Ripple.Defaults()
+}
+
+// ExptConfig is the experiment configuration that can be loaded from, and is
+// saved to, a JSON file.  It holds the experiment-level Sim fields plus the
+// Task and Slp blocks -- fields that are missing from a loaded file keep their
+// current values, so a file only needs to list what differs from the defaults.
+type ExptConfig struct {
+	ParamSet     string      `desc:"which set of *additional* parameters to use -- always applies Base and optionaly this next if set"`
+	Tag          string      `desc:"extra tag string to add to any file names output from sim"`
+	RndSeed      int64       `desc:"master random seed -- 0 = new seed based on the time"`
+	MaxRuns      int         `desc:"maximum number of model runs to perform"`
+	MaxEpcs      int         `desc:"maximum number of epochs to run per model run"`
+	NZeroStop    int         `desc:"if a positive number, training will stop after this many epochs with zero mem errors"`
+	TrialPerEpc  int         `desc:"number of trials per epoch of training"`
+	TestInterval int         `desc:"how often to run through all the test patterns, in terms of training epochs -- 0 or -1 for no testing, in which case the test stats of the run log are NaN"`
+	ExecSleep    bool        `desc:"sleep once criterion is reached"`
+	InhibOscil   bool        `desc:"whether to implement inhibition oscillation during sleep"`
+	SynDep       bool        `desc:"synaptic depression during sleep"`
+	SlpLearn     bool        `desc:"learning during sleep"`
+	Task         TaskParams  `desc:"task and criterion settings"`
+	Slp          SleepParams `desc:"sleep settings"`
+	Sched        SchedParams `desc:"when to sleep -- at criterion, or during training"`
+}
+
+// ExptConfig returns the current experiment configuration of the sim
+func (ss *Sim) ExptConfig() *ExptConfig {
+	return &ExptConfig{
+		ParamSet:     ss.ParamSet,
+		Tag:          ss.Tag,
+		RndSeed:      ss.RndSeed,
+		MaxRuns:      ss.MaxRuns,
+		MaxEpcs:      ss.MaxEpcs,
+		NZeroStop:    ss.NZeroStop,
+		TrialPerEpc:  ss.TrialPerEpc,
+		TestInterval: ss.TestInterval,
+		ExecSleep:    ss.ExecSleep,
+		InhibOscil:   ss.InhibOscil,
+		SynDep:       ss.SynDep,
+		SlpLearn:     ss.SlpLearn,
+		Task:         ss.Task,
+		Slp:          ss.Slp,
+		Sched:        ss.Sched,
+	}
+}
+
+// ApplyExptConfig sets the sim from the given configuration, re-opening the
+// patterns if they changed.  Call Init afterward for it to take effect.
+func (ss *Sim) ApplyExptConfig(ec *ExptConfig) {
+	repats := ec.Task.TrainPats != ss.Task.TrainPats || ec.Task.TestPats != ss.Task.TestPats
+	ss.ParamSet = ec.ParamSet
+	ss.Tag = ec.Tag
+	if ec.RndSeed != 0 {
+		ss.RndSeed = ec.RndSeed
+	}
+	ss.MaxRuns = ec.MaxRuns
+	ss.MaxEpcs = ec.MaxEpcs
+	ss.NZeroStop = ec.NZeroStop
+	ss.TrialPerEpc = ec.TrialPerEpc
+	ss.TestInterval = ec.TestInterval
+	ss.ExecSleep = ec.ExecSleep
+	ss.InhibOscil = ec.InhibOscil
+	ss.SynDep = ec.SynDep
+	ss.SlpLearn = ec.SlpLearn
+	ss.Task = ec.Task
+	relog := !SameNames(ec.Slp.OscGroups.Names(), ss.Slp.OscGroups.Names())
+	ss.Slp = ec.Slp
+	ss.Sched = ec.Sched
+	if repats {
+		ss.OpenPats()
+	}
+	if relog && ss.SlpCycLog != nil {
+		ss.ConfigSlpCycLog(ss.SlpCycLog) // has a column for each group
+	}
+}
+
+// Validate checks the configuration for values the sim can't run with,
+// returning an error that lists every problem found, or nil if it is ok
+func (ec *ExptConfig) Validate(ss *Sim) error {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	frac := func(nm string, v float64) {
+		if math.IsNaN(v) || v < 0 || v > 1 {
+			bad("%s must be between 0 and 1, is: %g", nm, v)
+		}
+	}
+	pset := ec.ParamSet == "" || HasName(ss.ParamSetNames(), ec.ParamSet)
+	if !pset {
+		bad("ParamSet %q is not one of the param sets: %s", ec.ParamSet, strings.Join(ss.ParamSetNames(), ", "))
+	}
+	if ec.MaxRuns <= 0 {
+		bad("MaxRuns must be > 0, is: %d", ec.MaxRuns)
+	}
+	if ec.MaxEpcs <= 0 {
+		bad("MaxEpcs must be > 0, is: %d", ec.MaxEpcs)
+	}
+	if ec.NZeroStop < 0 {
+		bad("NZeroStop must be >= 0, is: %d", ec.NZeroStop)
+	}
+	if ec.TrialPerEpc <= 0 {
+		bad("TrialPerEpc must be > 0, is: %d", ec.TrialPerEpc)
+	}
+	// TestInterval <= 0 is allowed: there is no testing, and so no sleep at criterion (see LogRun)
+	tp := &ec.Task
+	if tp.TrainPats == "" {
+		bad("Task.TrainPats must be set")
+	}
+	if tp.TestPats == "" {
+		bad("Task.TestPats must be set")
+	}
+	frac("Task.CritShPctCor", tp.CritShPctCor)
+	frac("Task.CritUnPctCor", tp.CritUnPctCor)
+	frac("Task.SharedHideP", tp.SharedHideP)
+	frac("Task.CodeHideP", tp.CodeHideP)
+	sp := &ec.Slp
+	if sp.Cycles <= 0 {
+		bad("Slp.Cycles must be > 0, is: %d", sp.Cycles)
+	}
+	if sp.Bouts <= 0 {
+		bad("Slp.Bouts must be > 0, is: %d", sp.Bouts)
+	}
+	if sp.WtLogCycs < 0 {
+		bad("Slp.WtLogCycs must be >= 0, is: %d", sp.WtLogCycs)
+	}
+	errs = append(errs, sp.OscGroups.Validate(ss.LayerNames())...)
+	errs = append(errs, sp.ValidateStages()...)
+	errs = append(errs, ec.Sched.Validate()...)
+	if !HasName(SynDepModels, sp.SynDepModel) {
+		bad("Slp.SynDepModel %q is not one of: %s", sp.SynDepModel, strings.Join(SynDepModels, ", "))
+	}
+	if sp.SynDepInc < 0 || sp.SynDepDec < 0 {
+		bad("Slp.SynDepInc and SynDepDec must be >= 0, are: %g, %g", sp.SynDepInc, sp.SynDepDec)
+	}
+	if pset {
+		if pds, err := ss.PrjnSynDeps(sp, ec.ParamSet, false); err != nil {
+			bad("SynDep params: %v", err)
+		} else {
+			for _, pd := range pds {
+				if pd.SynDep.Inc < 0 || pd.SynDep.Dec < 0 {
+					bad("SynDep params: Inc and Dec of %s must be >= 0, are: %g, %g", pd.Name(), pd.SynDep.Inc, pd.SynDep.Dec)
+				}
+			}
+		}
+	}
+	if sp.CA3RecAbs < 0 || sp.CA1PerAbs < 0 {
+		bad("Slp.CA3RecAbs and CA1PerAbs must be >= 0, are: %g, %g", sp.CA3RecAbs, sp.CA1PerAbs)
+	}
+	if !(sp.MinusThr < sp.PlusThr) {
+		bad("Slp.MinusThr must be < Slp.PlusThr, are: %g, %g", sp.MinusThr, sp.PlusThr)
+	}
+	errs = append(errs, sp.Stability.Validate(ss.LayerNames())...)
+	if sp.Calib.On {
+		errs = append(errs, sp.Calib.Validate()...)
+	}
+	if sp.StableCycs <= 0 {
+		bad("Slp.StableCycs must be > 0, is: %d", sp.StableCycs)
+	}
+	errs = append(errs, sp.Noise.Validate(ss.LayerNames())...)
+	errs = append(errs, sp.Plasticity.Validate()...)
+	errs = append(errs, sp.Homeo.Validate(ss.PrjnNames(), sp.StageNames())...)
+	if pset {
+		if pps, err := ss.PrjnPlasticities(sp, ec.ParamSet, false); err != nil {
+			bad("Plasticity params: %v", err)
+		} else {
+			for _, pp := range pps {
+				if pp.Plasticity.Rule != sp.Plasticity.Rule && !HasName(SlpRules, pp.Plasticity.Rule) { // the default is checked above
+					bad("Plasticity params: Rule of %s %q is not one of: %s", pp.Name(), pp.Plasticity.Rule, strings.Join(SlpRules, ", "))
+				}
+			}
+		}
+	}
+	errs = append(errs, sp.Cue.Validate(ss.LayerNames(), sp.StageNames())...)
+	errs = append(errs, sp.Ripple.Validate(sp)...)
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// ParamSetNames returns the names of all the param sets
+func (ss *Sim) ParamSetNames() []string {
+	nms := make([]string, len(ss.Params))
+	for i, ps := range ss.Params {
+		nms[i] = ps.Name
+	}
+	return nms
+}
+
+// HasName returns true if nm is in the list of names
+func HasName(nms []string, nm string) bool {
+	for _, n := range nms {
+		if n == nm {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenExptConfig loads an experiment configuration from the given JSON file on top
+// of the current configuration, validates it, and applies it to the sim.
+// Unknown fields are an error, to catch typos.  Nothing is applied if there
+// are any errors.  Call Init afterward for it to take effect.
+func (ss *Sim) OpenExptConfig(filename gi.FileName) error {
+	b, err := ioutil.ReadFile(string(filename))
+	if err != nil {
+		return err
+	}
+	ec := ss.ExptConfig()
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(ec); err != nil {
+		var serr *json.SyntaxError
+		var terr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &serr):
+			return fmt.Errorf("%s:%d: %v", filename, LineOfOffset(b, serr.Offset), err)
+		case errors.As(err, &terr):
+			return fmt.Errorf("%s:%d: %s must be %s, not %s", filename, LineOfOffset(b, terr.Offset), terr.Field, terr.Type, terr.Value)
+		}
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if err := ec.Validate(ss); err != nil {
+		return fmt.Errorf("%s: invalid config:\n  %v", filename, err)
+	}
+	ss.ApplyExptConfig(ec)
+	return nil
+}
+
+// SaveExptConfig saves the current experiment configuration to the given JSON
+// file, which can be loaded with OpenExptConfig to regenerate the results
+func (ss *Sim) SaveExptConfig(filename gi.FileName) error {
+	b, err := json.MarshalIndent(ss.ExptConfig(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(string(filename), append(b, '\n'), 0644)
+}
+
+// ExptConfigFileName returns the default name of the resolved configuration saved
+// with the outputs of this run
+func (ss *Sim) ExptConfigFileName() string {
+	return ss.OutFile(ss.Net.Nm + "_" + ss.RunName() + "_config.json")
+}
+
+// LineOfOffset returns the 1-based line number of the given byte offset in b
+func LineOfOffset(b []byte, off int64) int {
+	if off > int64(len(b)) {
+		off = int64(len(b))
+	}
+	return 1 + bytes.Count(b[:off], []byte("\n"))
+}
+
+// SameNames returns true if the two lists have the same names in the same order
+func SameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// LayerNames returns the names of all the layers of the network
+func (ss *Sim) LayerNames() []string {
+	nms := make([]string, len(ss.Net.Layers))
+	for i, ly := range ss.Net.Layers {
+		nms[i] = ly.Name()
+	}
+	return nms
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goki/gi/gi"
+)
+
+// newTestSim returns a new sim, configured and initialized as from the command
+// line, with the given master seed
+func newTestSim(t *testing.T, seed int64) *Sim {
+	t.Helper()
+	ss := &Sim{}
+	ss.New()
+	ss.RndSeed = seed
+	ss.NoGui = true
+	ss.ViewOn = false
+	ss.Config()
+	ss.Init()
+	return ss
+}
+
+func TestOpenExptConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name string
+		json string
+		err  string // part of the error, "" for none
+	}{
+		{"valid", `{"MaxRuns": 3, "Slp": {"Cycles": 500}}`, ""},
+		{"unknown", `{"MaxRuns": 3, "MaxRun": 3}`, `unknown field "MaxRun"`},
+		{"unknown nested", `{"Slp": {"Cycles": 500, "Cycels": 400}}`, `unknown field "Cycels"`},
+		{"unknown in group", `{"Slp": {"OscGroups": [{"Name": "All", "Osc": {"Type": "sine", "Freq": 0.1, "Offset": 1}, "Layer": ["CA3"]}]}}`, `unknown field "Layer"`},
+		{"type", "{\n  \"MaxRuns\": \"3\"\n}", ":2: MaxRuns must be int, not string"},
+		{"syntax", "{\n  \"MaxRuns\": 3,\n}", ":3: "},
+		{"invalid", `{"MaxRuns": 0}`, "MaxRuns must be > 0"},
+	}
+	for _, tt := range tests {
+		ss := &Sim{}
+		ss.New()
+		ss.Config()
+		fnm := filepath.Join(dir, tt.name+".json")
+		if err := ioutil.WriteFile(fnm, []byte(tt.json), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := ss.OpenExptConfig(gi.FileName(fnm))
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && err == nil:
+			t.Errorf("%s: no error, want %q", tt.name, tt.err)
+		case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+			t.Errorf("%s: error %q, want %q", tt.name, err, tt.err)
+		}
+		if tt.err != "" && ss.MaxRuns != 30 {
+			t.Errorf("%s: MaxRuns = %d after an error, want it left as it was", tt.name, ss.MaxRuns)
+		}
+	}
+}
+
+func TestOpenExptConfigApplies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fnm := filepath.Join(dir, "cfg.json")
+	if err := ioutil.WriteFile(fnm, []byte(`{"MaxRuns": 3, "Slp": {"Cycles": 500, "Noise": {"Thr": 0.5}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ss := &Sim{}
+	ss.New()
+	ss.Config()
+	if err := ss.OpenExptConfig(gi.FileName(fnm)); err != nil {
+		t.Fatal(err)
+	}
+	if ss.MaxRuns != 3 || ss.Slp.Cycles != 500 || ss.Slp.Noise.Thr != 0.5 {
+		t.Errorf("MaxRuns, Slp.Cycles, Slp.Noise.Thr = %d, %d, %g, want 3, 500, 0.5", ss.MaxRuns, ss.Slp.Cycles, ss.Slp.Noise.Thr)
+	}
+	if ss.Slp.Noise.Period != 50 || ss.Slp.CA3RecAbs != 2 {
+		t.Errorf("fields that aren't in the file changed: Slp.Noise.Period = %d, Slp.CA3RecAbs = %g", ss.Slp.Noise.Period, ss.Slp.CA3RecAbs)
+	}
+}
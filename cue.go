@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// CueParams are the settings of targeted memory reactivation (TMR): cueing items
+// during sleep with weak external input to some of their layers.  Starting at
+// cycle Start of each sleep trial, a cue is presented for Dur cycles every Period
+// cycles, going through Items in order.  The tests are then split into the cued
+// and uncued items (the Cu and Uc stats of the test epoch and run logs).
+type CueParams struct {
+	Items    []string `desc:"names of the training items that are cued (the Name column of the training patterns) -- no cueing if empty"`
+	Layers   []string `desc:"layers that the cue is applied to, with the pattern of the item in each one"`
+	Strength float32  `def:"0.1" min:"0" desc:"strength of the cue -- the pattern, times this, is the soft-clamped external input (Ext) of the layer, which adds Ext * Act.Clamp.Gain to the excitatory input of each neuron"`
+	Start    int      `def:"200" min:"0" desc:"cycle of the sleep trial at which the first cue starts"`
+	Period   int      `def:"500" min:"1" desc:"number of cycles from the start of one cue to the next"`
+	Dur      int      `def:"50" min:"1" desc:"number of cycles each cue is presented for"`
+	N        int      `min:"0" desc:"number of cues per sleep trial -- 0 = as many as fit"`
+	Stages   []string `desc:"stages of sleep (see Slp.Stages) during which cues are presented -- all of them if empty -- cues that fall outside of them are skipped"`
+}
+
+// Defaults sets the default cue params
+func (cp *CueParams) Defaults() {
+	cp.Items = nil
+	cp.Layers = []string{"CodeName"}
+	cp.Strength = 0.1
+	cp.Start = 200
+	cp.Period = 500
+	cp.Dur = 50
+	cp.N = 0
+	cp.Stages = nil
+}
+
+// Validate returns a description of each problem with the cue params, given the
+// names of the layers of the network and of the stages of sleep -- the items are
+// checked against the training patterns once they are loaded (see CuePatterns)
+func (cp *CueParams) Validate(lays, stages []string) []string {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	if len(cp.Items) > 0 && len(cp.Layers) == 0 {
+		bad("Slp.Cue.Layers must list the layers to cue")
+	}
+	for _, lnm := range cp.Layers {
+		if !HasName(lays, lnm) {
+			bad("Slp.Cue.Layers: %q is not a layer of the network", lnm)
+		}
+	}
+	for _, snm := range cp.Stages {
+		if !HasName(stages, snm) {
+			bad("Slp.Cue.Stages: %q is not one of the stages of sleep: %s", snm, strings.Join(stages, ", "))
+		}
+	}
+	if math.IsNaN(float64(cp.Strength)) || cp.Strength < 0 {
+		bad("Slp.Cue.Strength must be >= 0, is: %g", cp.Strength)
+	}
+	if cp.Start < 0 {
+		bad("Slp.Cue.Start must be >= 0, is: %d", cp.Start)
+	}
+	if cp.Period <= 0 {
+		bad("Slp.Cue.Period must be > 0, is: %d", cp.Period)
+	}
+	if cp.Dur <= 0 || cp.Dur > cp.Period {
+		bad("Slp.Cue.Dur must be between 1 and Period (%d), is: %d", cp.Period, cp.Dur)
+	}
+	if cp.N < 0 {
+		bad("Slp.Cue.N must be >= 0, is: %d", cp.N)
+	}
+	return errs
+}
+
+// ItemAt returns the item that is cued at the given cycle of a sleep trial, in
+// the given stage, or "" if none is
+func (cp *CueParams) ItemAt(cyc int, stage string) string {
+	if len(cp.Items) == 0 || cyc < cp.Start || (len(cp.Stages) > 0 && !HasName(cp.Stages, stage)) {
+		return ""
+	}
+	k := (cyc - cp.Start) / cp.Period
+	if (cyc-cp.Start)%cp.Period >= cp.Dur || (cp.N > 0 && k >= cp.N) {
+		return ""
+	}
+	return cp.Items[k%len(cp.Items)]
+}
+
+// StageNames returns the names of the stages of a sleep trial
+func (sp *SleepParams) StageNames() []string {
+	sts := sp.AllStages()
+	nms := make([]string, len(sts))
+	for i := range sts {
+		nms[i] = sts[i].Name
+	}
+	return nms
+}
+
+// CuePatterns returns the cue of each item of Slp.Cue: the pattern of each cued
+// layer, times Strength, from the first row of the training patterns with its name
+func (ss *Sim) CuePatterns() (map[string]map[string][]float32, error) {
+	cp := &ss.Slp.Cue
+	dt := ss.TrainSat
+	pats := make(map[string]map[string][]float32, len(cp.Items))
+	for _, it := range cp.Items {
+		if _, has := pats[it]; has {
+			continue
+		}
+		row := -1
+		for r := 0; r < dt.Rows; r++ {
+			if dt.CellString("Name", r) == it {
+				row = r
+				break
+			}
+		}
+		if row < 0 {
+			return nil, fmt.Errorf("Slp.Cue.Items: %q is not an item of the training patterns", it)
+		}
+		lpats := make(map[string][]float32, len(cp.Layers))
+		for _, lnm := range cp.Layers {
+			tsr, err := dt.CellTensorTry(lnm, row)
+			if err != nil {
+				return nil, fmt.Errorf("Slp.Cue.Layers: %v", err)
+			}
+			pat := make([]float32, tsr.Len())
+			for i := range pat {
+				pat[i] = cp.Strength * float32(tsr.FloatVal1D(i))
+			}
+			lpats[lnm] = pat
+		}
+		pats[it] = lpats
+	}
+	return pats, nil
+}
+
+// StartCues sets the cued layers up for the soft-clamped cues at the start of a
+// sleep trial -- the clamping of input layers is hard, which would ignore them
+func (ss *Sim) StartCues() {
+	if len(ss.Slp.Cue.Items) == 0 || ss.CueClampHard != nil {
+		return
+	}
+	ss.CueClampHard = make(map[string]bool, len(ss.Slp.Cue.Layers))
+	for _, lnm := range ss.Slp.Cue.Layers {
+		ly := ss.Net.LayerByName(lnm).(leabra.LeabraLayer).AsLeabra()
+		ss.CueClampHard[lnm] = ly.Act.Clamp.Hard
+		ly.Act.Clamp.Hard = false
+	}
+}
+
+// EndCues removes any cue, and puts the clamping of the cued layers back, at the
+// end of a sleep trial
+func (ss *Sim) EndCues() {
+	for lnm, hard := range ss.CueClampHard {
+		ly := ss.Net.LayerByName(lnm).(leabra.LeabraLayer).AsLeabra()
+		ly.InitExt()
+		ly.Act.Clamp.Hard = hard
+	}
+	ss.CueClampHard = nil
+	ss.CueItem = ""
+}
+
+// ApplyCue applies the cue of the given cycle of sleep, in the given stage, if it
+// differs from the last one -- none during the calibration segment
+func (ss *Sim) ApplyCue(cyc int, stage string) {
+	if len(ss.Slp.Cue.Items) == 0 {
+		return
+	}
+	item := ss.Slp.Cue.ItemAt(cyc, stage)
+	if ss.SlpCalib {
+		item = ""
+	}
+	if item == ss.CueItem {
+		return
+	}
+	for _, lnm := range ss.Slp.Cue.Layers {
+		ly := ss.Net.LayerByName(lnm).(leabra.LeabraLayer).AsLeabra()
+		if item == "" {
+			ly.InitExt()
+		} else {
+			ly.ApplyExt1D32(ss.CuePats[item][lnm])
+		}
+	}
+	ss.CueItem = item
+}
+
+// CueTrialStats adds the stats of the test trial that was just run on the given
+// item to those of the cued or uncued items
+func (ss *Sim) CueTrialStats(item string) {
+	if HasName(ss.Slp.Cue.Items, item) {
+		ss.CuTrlNum++
+		ss.CuSumSSE += ss.TrlSSE
+		if ss.TrlSSE != 0 {
+			ss.CuCntErr++
+		}
+	} else {
+		ss.UcTrlNum++
+		ss.UcSumSSE += ss.TrlSSE
+		if ss.TrlSSE != 0 {
+			ss.UcCntErr++
+		}
+	}
+}
+
+// CueEpcStats computes the cued and uncued stats of the test that just ended,
+// and starts them over -- they are NaN for a group with no trials
+func (ss *Sim) CueEpcStats() {
+	cunt := float64(ss.CuTrlNum)
+	ss.EpcCuSSE = ss.CuSumSSE / cunt
+	ss.EpcCuPctCor = 1 - float64(ss.CuCntErr)/cunt
+	ss.CuTrlNum, ss.CuSumSSE, ss.CuCntErr = 0, 0, 0
+
+	ucnt := float64(ss.UcTrlNum)
+	ss.EpcUcSSE = ss.UcSumSSE / ucnt
+	ss.EpcUcPctCor = 1 - float64(ss.UcCntErr)/ucnt
+	ss.UcTrlNum, ss.UcSumSSE, ss.UcCntErr = 0, 0, 0
+}
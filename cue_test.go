@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// cueWindows returns each stretch of cycles of a 2000 cycle sleep trial in which
+// an item is cued, as start-end:item, with the stage of each cycle from stage
+func cueWindows(cp *CueParams, stage func(cyc int) string) []string {
+	var wins []string
+	cur, st := "", 0
+	for cyc := 0; cyc <= 2000; cyc++ {
+		it := ""
+		if cyc < 2000 {
+			it = cp.ItemAt(cyc, stage(cyc))
+		}
+		if it == cur {
+			continue
+		}
+		if cur != "" {
+			wins = append(wins, fmt.Sprintf("%d-%d:%s", st, cyc, cur))
+		}
+		cur, st = it, cyc
+	}
+	return wins
+}
+
+func TestCueItemAt(t *testing.T) {
+	sleep := func(cyc int) string { return "Sleep" }
+	cp := &CueParams{}
+	cp.Defaults() // Start 200, Period 500, Dur 50
+	if wins := cueWindows(cp, sleep); len(wins) != 0 {
+		t.Errorf("no Items: cued %v", wins)
+	}
+
+	cp.Items = []string{"A", "B"}
+	want := []string{"200-250:A", "700-750:B", "1200-1250:A", "1700-1750:B"} // round and round the items
+	if wins := cueWindows(cp, sleep); !reflect.DeepEqual(wins, want) {
+		t.Errorf("cued %v, want %v", wins, want)
+	}
+
+	cp.N = 3
+	if wins := cueWindows(cp, sleep); !reflect.DeepEqual(wins, want[:3]) {
+		t.Errorf("N 3: cued %v, want %v", wins, want[:3])
+	}
+
+	// cues that fall in other stages are skipped, not put off
+	cp.N = 0
+	cp.Stages = []string{"SWS"}
+	swsThenREM := func(cyc int) string {
+		if cyc >= 210 && cyc < 1000 {
+			return "SWS"
+		}
+		return "REM"
+	}
+	want = []string{"210-250:A", "700-750:B"}
+	if wins := cueWindows(cp, swsThenREM); !reflect.DeepEqual(wins, want) {
+		t.Errorf("in SWS: cued %v, want %v", wins, want)
+	}
+}
@@ -10,4 +10,5 @@ require (
 	github.com/goki/ki v1.0.1
 	github.com/goki/mat32 v1.0.1
 	github.com/schapirolab/leabra-sleep v0.0.0-20201024143155-4cd18da3379a
+	gonum.org/v1/gonum v0.7.0
 )
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/schapirolab/leabra-sleep/leabra"
+	"gonum.org/v1/gonum/stat"
+)
+
+// HomeoModes are the ways the weights are downscaled by synaptic homeostasis
+// during sleep (see Slp.Homeo)
+var HomeoModes = []string{"mult", "mean"}
+
+// HomeoParams are the settings of synaptic homeostasis during sleep: the global
+// downscaling of the weights that the synaptic homeostasis hypothesis (SHY)
+// proposes.  Starting at cycle Start of each sleep trial, the weights of every
+// learnable prjn are downscaled every Period cycles.  It runs alongside the plus
+// and minus phase learning, or instead of it with SlpLearn off.
+type HomeoParams struct {
+	On     bool     `desc:"whether to downscale the weights during sleep"`
+	Mode   string   `def:"mult" desc:"how the weights are downscaled: mult = multiplied by 1 - Rate; mean = moved Rate of the way toward the WtInit.Mean of the prjn"`
+	Rate   float32  `def:"0.001" min:"0" max:"1" desc:"rate of each downscaling (see Mode)"`
+	Prjns  []string `desc:"names of the prjns that are downscaled (e.g., CA3ToCA3) -- all of the learnable ones (Learn.Learn) if empty"`
+	Start  int      `def:"0" min:"0" desc:"cycle of the sleep trial at which the first downscaling happens"`
+	Period int      `def:"100" min:"1" desc:"number of cycles between downscalings"`
+	Stages []string `desc:"stages of sleep (see Slp.Stages) during which the weights are downscaled -- all of them if empty"`
+}
+
+// Defaults sets the default homeostasis params
+func (hp *HomeoParams) Defaults() {
+	hp.On = false
+	hp.Mode = "mult"
+	hp.Rate = 0.001
+	hp.Prjns = nil
+	hp.Start = 0
+	hp.Period = 100
+	hp.Stages = nil
+}
+
+// Validate returns a description of each problem with the homeostasis params,
+// given the names of the prjns of the network and of the stages of sleep
+func (hp *HomeoParams) Validate(pjs, stages []string) []string {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	if !HasName(HomeoModes, hp.Mode) {
+		bad("Slp.Homeo.Mode %q is not one of: %s", hp.Mode, strings.Join(HomeoModes, ", "))
+	}
+	if math.IsNaN(float64(hp.Rate)) || hp.Rate < 0 || hp.Rate > 1 {
+		bad("Slp.Homeo.Rate must be between 0 and 1, is: %g", hp.Rate)
+	}
+	for _, pnm := range hp.Prjns {
+		if !HasName(pjs, pnm) {
+			bad("Slp.Homeo.Prjns: %q is not a prjn of the network", pnm)
+		}
+	}
+	for _, snm := range hp.Stages {
+		if !HasName(stages, snm) {
+			bad("Slp.Homeo.Stages: %q is not one of the stages of sleep: %s", snm, strings.Join(stages, ", "))
+		}
+	}
+	if hp.Start < 0 {
+		bad("Slp.Homeo.Start must be >= 0, is: %d", hp.Start)
+	}
+	if hp.Period <= 0 {
+		bad("Slp.Homeo.Period must be > 0, is: %d", hp.Period)
+	}
+	return errs
+}
+
+// Due returns true if the weights are downscaled at the given cycle of a sleep
+// trial, in the given stage
+func (hp *HomeoParams) Due(cyc int, stage string) bool {
+	if !hp.On || cyc < hp.Start || (len(hp.Stages) > 0 && !HasName(hp.Stages, stage)) {
+		return false
+	}
+	return (cyc-hp.Start)%hp.Period == 0
+}
+
+// Targets returns true if the given prjn is downscaled
+func (hp *HomeoParams) Targets(pj *leabra.Prjn) bool {
+	if len(hp.Prjns) == 0 {
+		return pj.Learn.Learn
+	}
+	return HasName(hp.Prjns, pj.Name())
+}
+
+// PrjnNames returns the names of the prjns of the network (see SynDepPrjns)
+func (ss *Sim) PrjnNames() []string {
+	pjs := ss.SynDepPrjns()
+	nms := make([]string, len(pjs))
+	for i, pj := range pjs {
+		nms[i] = pj.Name()
+	}
+	return nms
+}
+
+// WtStats is the mean and variance of the weights of a prjn
+type WtStats struct {
+	Mean float64
+	Var  float64
+}
+
+// PrjnWtStats returns the mean and variance of the weights of each prjn, in the
+// order of SynDepPrjns
+func (ss *Sim) PrjnWtStats() []WtStats {
+	pjs := ss.SynDepPrjns()
+	wss := make([]WtStats, len(pjs))
+	for i, pji := range pjs {
+		pj := pji.AsLeabra()
+		wts := make([]float64, len(pj.Syns))
+		for si := range pj.Syns {
+			wts[si] = float64(pj.Syns[si].Wt)
+		}
+		wss[i].Mean, wss[i].Var = math.NaN(), math.NaN()
+		if len(wts) > 1 {
+			wss[i].Mean, wss[i].Var = stat.MeanVariance(wts, nil)
+		}
+	}
+	return wss
+}
+
+// HomeoCyc downscales the weights of the target prjns, if it is due at the given
+// cycle of sleep, in the given stage -- not during the calibration segment
+func (ss *Sim) HomeoCyc(cyc int, stage string) {
+	hp := &ss.Slp.Homeo
+	if ss.SlpCalib || !hp.Due(cyc, stage) {
+		return
+	}
+	for _, pji := range ss.SynDepPrjns() {
+		pj := pji.AsLeabra()
+		if !hp.Targets(pj) {
+			continue
+		}
+		for si := range pj.Syns {
+			sy := &pj.Syns[si]
+			if hp.Mode == "mean" {
+				sy.Wt += hp.Rate * (float32(pj.WtInit.Mean)*sy.Scale - sy.Wt)
+			} else {
+				sy.Wt *= 1 - hp.Rate
+			}
+			pj.Learn.LWtFmWt(sy)
+		}
+	}
+	ss.SlpHomeoN++
+}
+
+// LogSlpWt adds a row for each prjn to the SlpWtLog, at the end of a sleep trial:
+// the mean and variance of its weights before and after the sleep, and the number
+// of times it was downscaled
+func (ss *Sim) LogSlpWt(dt *etable.Table) {
+	post := ss.PrjnWtStats()
+	hp := &ss.Slp.Homeo
+	for i, pji := range ss.SynDepPrjns() {
+		pj := pji.AsLeabra()
+		row := dt.Rows
+		dt.SetNumRows(row + 1)
+		dt.SetCellFloat("Run", row, float64(ss.TrainEnv.Run.Cur))
+		dt.SetCellFloat("Epoch", row, float64(ss.TrainEnv.Epoch.Cur))
+		dt.SetCellFloat("Bout", row, float64(ss.SlpBout+1))
+		dt.SetCellString("Prjn", row, pj.Name())
+		if i < len(ss.PreSlpWts) {
+			dt.SetCellFloat("PreMean", row, ss.PreSlpWts[i].Mean)
+			dt.SetCellFloat("PreVar", row, ss.PreSlpWts[i].Var)
+		}
+		dt.SetCellFloat("PostMean", row, post[i].Mean)
+		dt.SetCellFloat("PostVar", row, post[i].Var)
+		ndown := 0
+		if hp.Targets(pj) {
+			ndown = ss.SlpHomeoN
+		}
+		dt.SetCellFloat("Downscales", row, float64(ndown))
+
+		WriteLogRow(ss.SlpWtFile, dt, row)
+	}
+}
+
+// ConfigSlpWtLog configures the SlpWtLog, with a row per prjn per sleep trial in the run
+func (ss *Sim) ConfigSlpWtLog(dt *etable.Table) {
+	dt.SetMetaData("name", "SlpWtLog")
+	dt.SetMetaData("desc", "Mean and variance of the weights of each prjn before and after each sleep trial, and its downscalings (see Slp.Homeo)")
+	dt.SetMetaData("read-only", "true")
+	dt.SetMetaData("precision", strconv.Itoa(LogPrec))
+
+	sch := etable.Schema{
+		{"Run", etensor.INT64, nil, nil},
+		{"Epoch", etensor.INT64, nil, nil},
+		{"Bout", etensor.INT64, nil, nil},
+		{"Prjn", etensor.STRING, nil, nil},
+		{"PreMean", etensor.FLOAT64, nil, nil},
+		{"PreVar", etensor.FLOAT64, nil, nil},
+		{"PostMean", etensor.FLOAT64, nil, nil},
+		{"PostVar", etensor.FLOAT64, nil, nil},
+		{"Downscales", etensor.INT64, nil, nil},
+	}
+	dt.SetFromSchema(sch, 0)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHomeoDue(t *testing.T) {
+	hp := &HomeoParams{}
+	hp.Defaults()
+	hp.Start = 30
+	due := func(stage func(cyc int) string) []int {
+		var cycs []int
+		for cyc := 0; cyc < 400; cyc++ {
+			if hp.Due(cyc, stage(cyc)) {
+				cycs = append(cycs, cyc)
+			}
+		}
+		return cycs
+	}
+	sleep := func(cyc int) string { return "Sleep" }
+	if cycs := due(sleep); len(cycs) != 0 {
+		t.Errorf("off: due at %v", cycs)
+	}
+	hp.On = true
+	if cycs, want := due(sleep), []int{30, 130, 230, 330}; !reflect.DeepEqual(cycs, want) {
+		t.Errorf("due at %v, want %v", cycs, want)
+	}
+	hp.Stages = []string{"SWS"}
+	swsThenREM := func(cyc int) string {
+		if cyc < 200 {
+			return "SWS"
+		}
+		return "REM"
+	}
+	if cycs, want := due(swsThenREM), []int{30, 130}; !reflect.DeepEqual(cycs, want) {
+		t.Errorf("in SWS: due at %v, want %v", cycs, want)
+	}
+}
+
+// TestHomeoCyc checks the two ways of downscaling: mult shrinks every weight,
+// while mean pulls them all toward the WtInit.Mean of the prjn, from either side
+func TestHomeoCyc(t *testing.T) {
+	wts := []float32{0.1, 0.5, 0.9}
+	tests := []struct {
+		mode string
+		want []float32
+	}{
+		{"mult", []float32{0.05, 0.25, 0.45}},
+		{"mean", []float32{0.3, 0.5, 0.7}},
+	}
+	for _, tt := range tests {
+		net, pj := newTestNet(t)
+		pj.WtInit.Mean = 0.5
+		ss := &Sim{Net: net}
+		ss.Slp.Homeo.Defaults()
+		ss.Slp.Homeo.On = true
+		ss.Slp.Homeo.Mode = tt.mode
+		ss.Slp.Homeo.Rate = 0.5
+		for si := range pj.Syns {
+			pj.Syns[si].Scale = 1
+			pj.Syns[si].Wt = wts[si%3]
+		}
+		ss.HomeoCyc(0, "Sleep")
+		ss.HomeoCyc(50, "Sleep") // not due
+		for si := range pj.Syns {
+			sy := pj.Syns[si]
+			if want := tt.want[si%3]; math.Abs(float64(sy.Wt-want)) > 1e-6 {
+				t.Errorf("%s: Wt %g downscaled to %g, want %g", tt.mode, wts[si%3], sy.Wt, want)
+			}
+			lsy := sy
+			pj.Learn.LWtFmWt(&lsy)
+			if sy.LWt != lsy.LWt {
+				t.Errorf("%s: LWt = %g, not updated from the Wt: %g", tt.mode, sy.LWt, lsy.LWt)
+			}
+		}
+		if ss.SlpHomeoN != 1 {
+			t.Errorf("%s: SlpHomeoN = %d, want 1", tt.mode, ss.SlpHomeoN)
+		}
+	}
+
+	net, pj := newTestNet(t)
+	ss := &Sim{Net: net}
+	ss.Slp.Homeo.Defaults()
+	ss.Slp.Homeo.On = true
+	ss.Slp.Homeo.Prjns = []string{"BToA"}
+	wt := pj.Syns[0].Wt
+	ss.HomeoCyc(0, "Sleep")
+	if pj.Syns[0].Wt != wt {
+		t.Errorf("downscaled %s, which isn't in Prjns", pj.Name())
+	}
+}
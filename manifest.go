@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/emer/emergent/params"
+	"github.com/goki/gi/gi"
+)
+
+// Manifest records everything needed to know where the results in an output
+// directory came from, and to regenerate them.  It is saved as manifest.json in
+// the directory (see NewOutDir).
+type Manifest struct {
+	Started   string                   `desc:"time the command was started (RFC 3339)"`
+	Cmd       string                   `desc:"subcommand that was run -- empty for a full train -> sleep -> test run"`
+	Args      []string                 `desc:"command line, as given"`
+	Flags     map[string]string        `desc:"value of every flag of the command, including defaults"`
+	Config    ExptConfig               `desc:"fully resolved experiment config"`
+	ParamSets params.Sets              `desc:"the param sets that were applied -- Base and then ParamSet, if set"`
+	NetParams string                   `desc:"every param of every layer and prjn, as set (see Network.AllParams)"`
+	SlpRules  map[string]string        `desc:"learning rule of each prjn during sleep, by name (see Slp.Plasticity)"`
+	Seed      int64                    `desc:"master random seed"`
+	RunSeeds  map[int]map[string]int64 `desc:"seeds derived from the master seed for each run of the command, by run and stream name (see SeedStreams)"`
+	GoVersion string                   `desc:"version of Go the sim was built with"`
+	Modules   map[string]string        `desc:"version of the module and of each of its dependencies, as resolved from go.mod when built"`
+	Checksums map[string]string        `desc:"sha256 of the pattern files, the oscillation waveform files and any other files given on the command line, by file name"`
+}
+
+// Manifest returns the manifest for the given command, with the given flags and
+// input files, that does runs from TrainEnv.Run.Cur up to (not including) lastRun
+func (ss *Sim) Manifest(cmd string, fs *flag.FlagSet, lastRun int, inputs []string) *Manifest {
+	mf := &Manifest{
+		Started:   time.Now().Format(time.RFC3339),
+		Cmd:       cmd,
+		Args:      os.Args,
+		Flags:     make(map[string]string),
+		Config:    *ss.ExptConfig(),
+		NetParams: ss.Net.AllParams(),
+		SlpRules:  ss.SlpRulesByPrjn(),
+		Seed:      ss.RndSeed,
+		RunSeeds:  make(map[int]map[string]int64),
+		GoVersion: runtime.Version(),
+		Modules:   make(map[string]string),
+		Checksums: make(map[string]string),
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		mf.Flags[f.Name] = f.Value.String()
+	})
+	setNms := []string{"Base"} // as applied in SetParams
+	if ss.ParamSet != "" && ss.ParamSet != "Base" {
+		setNms = append(setNms, ss.ParamSet)
+	}
+	for _, nm := range setNms {
+		if ps, err := ss.Params.SetByNameTry(nm); err == nil {
+			mf.ParamSets = append(mf.ParamSets, ps)
+		}
+	}
+	for run := ss.TrainEnv.Run.Cur; run < lastRun; run++ {
+		seeds := make(map[string]int64, len(SeedStreams))
+		for _, nm := range SeedStreams {
+			seeds[nm] = DeriveSeed(ss.RndSeed, run, nm)
+		}
+		mf.RunSeeds[run] = seeds
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		mf.Modules[bi.Main.Path] = bi.Main.Version
+		for _, dep := range bi.Deps {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			mf.Modules[dep.Path] = dep.Version
+		}
+	}
+	inputs = append([]string{ss.Task.TrainPats, ss.Task.TestPats}, inputs...)
+	inputs = append(inputs, ss.Slp.OscFiles()...)
+	for _, fnm := range inputs {
+		if fnm == "" {
+			continue
+		}
+		if sum, err := FileChecksum(fnm); err == nil {
+			mf.Checksums[fnm] = sum
+		} else {
+			mf.Checksums[fnm] = err.Error()
+		}
+	}
+	return mf
+}
+
+// OscFiles returns the waveform files of all the file oscillations of sleep: those
+// of the OscGroups and those that stages override them with, without duplicates
+func (sp *SleepParams) OscFiles() []string {
+	var fnms []string
+	add := func(op *OscParams) {
+		if op.Type == "file" && !HasName(fnms, op.File) {
+			fnms = append(fnms, op.File)
+		}
+	}
+	for i := range sp.OscGroups {
+		add(&sp.OscGroups[i].Osc)
+	}
+	for _, st := range sp.Stages {
+		for _, og := range sp.OscGroups {
+			if op, has := st.Osc[og.Name]; has {
+				add(&op)
+			}
+		}
+	}
+	return fnms
+}
+
+// SaveManifest saves the manifest to the given JSON file
+func (mf *Manifest) SaveManifest(filename gi.FileName) error {
+	b, err := json.MarshalIndent(mf, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(string(filename), append(b, '\n'), 0644)
+}
+
+// FileChecksum returns the sha256 of the contents of the given file, in hex
+func FileChecksum(fnm string) (string, error) {
+	fp, err := os.Open(fnm)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewOutDir creates a new directory for the outputs of this invocation under the
+// given base directory, named by the network, RunName and the current time, and
+// sets OutDir to it so that all files are saved there (see OutFile)
+func (ss *Sim) NewOutDir(base string) error {
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return err
+	}
+	nm := ss.Net.Nm + "_" + ss.RunName() + "_" + time.Now().Format("20060102-150405")
+	dir := filepath.Join(base, nm)
+	for i := 2; ; i++ { // in case another invocation started in the same second
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		dir = filepath.Join(base, fmt.Sprintf("%s_%d", nm, i))
+	}
+	ss.OutDir = dir
+	return nil
+}
+
+// OutFile returns the given file name in the output directory (OutDir), or as is
+// if there is none (e.g., in the GUI)
+func (ss *Sim) OutFile(fnm string) string {
+	if ss.OutDir == "" {
+		return fnm
+	}
+	return filepath.Join(ss.OutDir, fnm)
+}
+
+// ManifestFileName returns the name of the manifest file in the output directory
+func (ss *Sim) ManifestFileName() string {
+	return ss.OutFile("manifest.json")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestRunSeeds(t *testing.T) {
+	ss := newTestSim(t, 11)
+	ss.TrainEnv.Run.Cur = 2
+	mf := ss.Manifest("train", flag.NewFlagSet("test", flag.ContinueOnError), 5, nil)
+	if len(mf.RunSeeds) != 3 {
+		t.Fatalf("seeds for %d runs, want 3 (runs 2-4)", len(mf.RunSeeds))
+	}
+	for run := 2; run < 5; run++ {
+		for _, nm := range SeedStreams {
+			if got, want := mf.RunSeeds[run][nm], DeriveSeed(11, run, nm); got != want {
+				t.Errorf("run %d %s seed = %d, want %d", run, nm, got, want)
+			}
+		}
+	}
+	if mf.Seed != 11 {
+		t.Errorf("Seed = %d, want 11", mf.Seed)
+	}
+}
+
+// TestManifestChecksums checks that every file the command reads is in the
+// checksums: the patterns, the inputs given, and the waveform files of file
+// oscillations whether set in a group or only in a stage that overrides it
+func TestManifestChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{"grp.tsv": "1\n0\n", "stage.tsv": "0\n1\n", "wts.gz": "wts"}
+	for fnm, txt := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, fnm), []byte(txt), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	grp := filepath.Join(dir, "grp.tsv")
+	stage := filepath.Join(dir, "stage.tsv")
+	wts := filepath.Join(dir, "wts.gz")
+	missing := filepath.Join(dir, "missing.gz")
+
+	ss := newTestSim(t, 1)
+	ss.Slp.OscGroups[0].Osc = OscParams{Type: "file", File: grp, Amp: 0.01, Offset: 1}
+	ss.Slp.Stages = SleepStages{
+		{Name: "SWS", Cycles: 100},
+		{Name: "REM", Cycles: 100, Osc: map[string]OscParams{ss.Slp.OscGroups[1].Name: {Type: "file", File: stage, Amp: 0.01, Offset: 1}}},
+	}
+	mf := ss.Manifest("sleep", flag.NewFlagSet("test", flag.ContinueOnError), 1, []string{wts, missing})
+
+	for _, fnm := range []string{ss.Task.TrainPats, ss.Task.TestPats, grp, stage, wts} {
+		want, err := FileChecksum(fnm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mf.Checksums[fnm]; got != want {
+			t.Errorf("checksum of %s = %q, want %q", fnm, got, want)
+		}
+	}
+	if sum := mf.Checksums[missing]; sum == "" || len(sum) == 64 {
+		t.Errorf("checksum of a missing file = %q, want the error", sum)
+	}
+	if len(mf.Checksums) != 6 {
+		t.Errorf("%d checksums, want 6: %v", len(mf.Checksums), mf.Checksums)
+	}
+}
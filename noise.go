@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/goki/mat32"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// NoiseDists are the distributions of the noise injected during sleep (see Slp.Noise)
+var NoiseDists = []string{"uniform", "gauss", "bernoulli"}
+
+// NoiseTriggers are the conditions under which noise is injected during sleep
+var NoiseTriggers = []string{"stability", "periodic", "continuous"}
+
+// NoiseParams are the settings of the noise that is injected into the activations
+// of the network during sleep.  By default, when AvgLaySim falls to Thr (most
+// likely because a layer has lost all activity), the activations of every
+// neuron are set to uniform noise for the first Cycs cycles of every Period, to
+// get the network going again.  The random activations that sleep starts from
+// are drawn from the same distribution.
+type NoiseParams struct {
+	Dist    string   `def:"uniform" desc:"distribution of the noise: uniform = uniform over Mag * [-0.5, 0.5); gauss = Gaussian with mean 0 and SD Mag; bernoulli = Mag with probability Prob, else 0 -- the activations are clipped to 0-1"`
+	Mag     float32  `def:"1" min:"0" desc:"magnitude of the noise (see Dist)"`
+	Prob    float32  `def:"0.1" min:"0" max:"1" desc:"for bernoulli, probability that a neuron is active"`
+	Add     bool     `desc:"add the noise to the activations, rather than replacing them with it -- e.g., for continuous background noise"`
+	Layers  []string `desc:"layers that noise is injected into -- all of them if empty -- the initial activations are always set in all layers"`
+	Trigger string   `def:"stability" desc:"when noise is injected: stability = when AvgLaySim is at or below Thr, during the first Cycs cycles of every Period; periodic = during the first Cycs cycles of every Period; continuous = every cycle -- never before Start"`
+	Thr     float64  `def:"0.8" desc:"for stability, noise is injected when AvgLaySim is at or below this value, e.g., because a layer has lost all activity"`
+	Start   int      `def:"200" min:"0" desc:"noise is never injected before this cycle, to let the network settle into an attractor"`
+	Period  int      `def:"50" min:"1" desc:"for stability and periodic, period in cycles at which noise can be injected"`
+	Cycs    int      `def:"5" min:"0" desc:"for stability and periodic, number of cycles at the start of each Period during which noise is injected"`
+}
+
+// Defaults sets the default noise params
+func (np *NoiseParams) Defaults() {
+	np.Dist = "uniform"
+	np.Mag = 1
+	np.Prob = 0.1
+	np.Add = false
+	np.Layers = nil
+	np.Trigger = "stability"
+	np.Thr = 0.8
+	np.Start = 200
+	np.Period = 50
+	np.Cycs = 5
+}
+
+// Validate returns a description of each problem with the noise params, given
+// the names of the layers of the network
+func (np *NoiseParams) Validate(lays []string) []string {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	if !HasName(NoiseDists, np.Dist) {
+		bad("Slp.Noise.Dist %q is not one of: %s", np.Dist, strings.Join(NoiseDists, ", "))
+	}
+	if math.IsNaN(float64(np.Mag)) || np.Mag < 0 {
+		bad("Slp.Noise.Mag must be >= 0, is: %g", np.Mag)
+	}
+	if np.Dist == "bernoulli" && !(np.Prob >= 0 && np.Prob <= 1) {
+		bad("Slp.Noise.Prob must be between 0 and 1, is: %g", np.Prob)
+	}
+	for _, lnm := range np.Layers {
+		if !HasName(lays, lnm) {
+			bad("Slp.Noise.Layers: %q is not a layer of the network", lnm)
+		}
+	}
+	if !HasName(NoiseTriggers, np.Trigger) {
+		bad("Slp.Noise.Trigger %q is not one of: %s", np.Trigger, strings.Join(NoiseTriggers, ", "))
+	}
+	if np.Start < 0 {
+		bad("Slp.Noise.Start must be >= 0, is: %d", np.Start)
+	}
+	if np.Period <= 0 {
+		bad("Slp.Noise.Period must be > 0, is: %d", np.Period)
+	}
+	if np.Cycs < 0 || np.Cycs > np.Period {
+		bad("Slp.Noise.Cycs must be between 0 and Period (%d), is: %d", np.Period, np.Cycs)
+	}
+	return errs
+}
+
+// Draw returns a sample of the noise, before it is clipped to the 0-1 range of
+// the activations
+func (np *NoiseParams) Draw(rnd *rand.Rand) float32 {
+	switch np.Dist {
+	case "gauss":
+		return np.Mag * float32(rnd.NormFloat64())
+	case "bernoulli":
+		if rnd.Float32() < np.Prob {
+			return np.Mag
+		}
+		return 0
+	}
+	return np.Mag * (rnd.Float32() - 0.5)
+}
+
+// Due returns true if noise is to be injected at the given cycle of sleep, with
+// the given AvgLaySim
+func (np *NoiseParams) Due(cyc int, avgsim float64) bool {
+	if cyc <= np.Start {
+		return false
+	}
+	switch np.Trigger {
+	case "periodic":
+		return cyc%np.Period < np.Cycs
+	case "continuous":
+		return true
+	}
+	return avgsim <= np.Thr && cyc%np.Period < np.Cycs
+}
+
+// NoiseLayers returns the layers that noise is injected into during sleep
+func (ss *Sim) NoiseLayers() []*leabra.Layer {
+	var lys []*leabra.Layer
+	for _, lyi := range ss.Net.Layers {
+		if len(ss.Slp.Noise.Layers) == 0 || HasName(ss.Slp.Noise.Layers, lyi.Name()) {
+			lys = append(lys, lyi.(*leabra.Layer))
+		}
+	}
+	return lys
+}
+
+// InjectNoise sets the activations of the neurons of the given layers to noise, or
+// adds noise to them (Slp.Noise.Add), from the given random stream, and returns
+// the number of neurons it was injected into
+func (ss *Sim) InjectNoise(lys []*leabra.Layer, rnd *rand.Rand, add bool) int {
+	np := &ss.Slp.Noise
+	n := 0
+	for _, ly := range lys {
+		for ni := range ly.Neurons {
+			nrn := &ly.Neurons[ni]
+			if nrn.IsOff() {
+				continue
+			}
+			act := np.Draw(rnd)
+			if add {
+				act += nrn.Act
+			}
+			nrn.Act = mat32.Min(mat32.Max(act, 0), 1)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// cycRange returns the cycles from lo up to (not including) hi, appended to cycs
+func cycRange(cycs []int, lo, hi int) []int {
+	for c := lo; c < hi; c++ {
+		cycs = append(cycs, c)
+	}
+	return cycs
+}
+
+func TestNoiseDue(t *testing.T) {
+	np := &NoiseParams{}
+	np.Defaults() // Thr 0.8, Start 200, Period 50, Cycs 5
+
+	avgsim := func(cyc int) float64 { // stable from 290 to 360
+		if cyc >= 290 && cyc < 360 {
+			return 0.9
+		}
+		return 0.5
+	}
+	due := func(trigger string) []int {
+		np.Trigger = trigger
+		var cycs []int
+		for cyc := 0; cyc <= 400; cyc++ {
+			if np.Due(cyc, avgsim(cyc)) {
+				cycs = append(cycs, cyc)
+			}
+		}
+		return cycs
+	}
+
+	// the first Cycs cycles of each Period after Start -- not at Start itself
+	var periodic []int
+	periodic = cycRange(periodic, 201, 205)
+	for _, c := range []int{250, 300, 350} {
+		periodic = cycRange(periodic, c, c+5)
+	}
+	periodic = append(periodic, 400)
+	if got := due("periodic"); !reflect.DeepEqual(got, periodic) {
+		t.Errorf("periodic: due at %v, want %v", got, periodic)
+	}
+
+	// the same, except while the network is stable
+	stability := cycRange(nil, 201, 205)
+	stability = cycRange(stability, 250, 255)
+	stability = append(stability, 400)
+	if got := due("stability"); !reflect.DeepEqual(got, stability) {
+		t.Errorf("stability: due at %v, want %v", got, stability)
+	}
+
+	if got, want := due("continuous"), cycRange(nil, 201, 401); !reflect.DeepEqual(got, want) {
+		t.Errorf("continuous: due at %v, want every cycle after Start", got)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// Oscillator generates the waveform of an inhibitory oscillation during sleep,
+// as a multiplier on the Inhib.Layer.Gi of the layers it drives
+type Oscillator interface {
+	// Val returns the value of the waveform at the given cycle of the sleep trial
+	Val(cyc int) float64
+}
+
+// OscTypes are the types of Oscillator that OscParams can make (see NewOscillator)
+var OscTypes = []string{"sine", "square", "saw", "thetagamma", "pink", "file"}
+
+// OscParams are the settings of an inhibitory oscillation.  The waveform swings
+// by Amp around Offset -- Freq and Phase are in radians (per cycle, and at cycle 0).
+type OscParams struct {
+	Type      string  `def:"sine" desc:"shape of the waveform: sine, square, saw (rising sawtooth), thetagamma (gamma nested in theta, with its amplitude following the theta phase), pink (1/f noise), or file (loaded from File)"`
+	Freq      float64 `def:"0.1" desc:"angular frequency, in radians per cycle -- of the theta rhythm for thetagamma, unused for pink and file"`
+	Amp       float64 `desc:"amplitude -- the waveform goes from Offset - Amp to Offset + Amp (for file, the values in the file are scaled by Amp)"`
+	Offset    float64 `def:"0.99" desc:"mean of the waveform"`
+	Phase     float64 `desc:"phase at cycle 0, in radians -- unused for pink and file"`
+	GammaFreq float64 `desc:"for thetagamma, angular frequency of the gamma rhythm, in radians per cycle"`
+	GammaAmp  float64 `desc:"for thetagamma, amplitude of the gamma rhythm at the peak of theta"`
+	File      string  `desc:"for file, the file to load the waveform from: one value per line (or the first column of a tab-separated file), repeated if the sleep trial is longer"`
+}
+
+// NewOscillator returns a new Oscillator of the type given in the params.  seed
+// is for the pink noise, which is always the same for the same seed.
+func NewOscillator(op *OscParams, seed int64) (Oscillator, error) {
+	switch op.Type {
+	case "sine":
+		return &SineOsc{*op}, nil
+	case "square":
+		return &SquareOsc{*op}, nil
+	case "saw":
+		return &SawOsc{*op}, nil
+	case "thetagamma":
+		return &ThetaGammaOsc{*op}, nil
+	case "pink":
+		return NewPinkOsc(op, seed), nil
+	case "file":
+		return OpenFileOsc(op)
+	}
+	return nil, fmt.Errorf("oscillation type %q is not one of: %s", op.Type, strings.Join(OscTypes, ", "))
+}
+
+// Validate returns a description of each problem with the params, prefixed with nm
+func (op *OscParams) Validate(nm string) []string {
+	var errs []string
+	switch op.Type {
+	case "sine", "square", "saw", "thetagamma":
+		if op.Freq <= 0 {
+			errs = append(errs, fmt.Sprintf("%s.Freq must be > 0, is: %g", nm, op.Freq))
+		}
+	case "pink":
+	case "file":
+		if _, err := OpenFileOsc(op); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.File: %v", nm, err))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("%s.Type %q is not one of: %s", nm, op.Type, strings.Join(OscTypes, ", ")))
+	}
+	if op.Type == "thetagamma" && op.GammaFreq <= 0 {
+		errs = append(errs, fmt.Sprintf("%s.GammaFreq must be > 0, is: %g", nm, op.GammaFreq))
+	}
+	if min := op.Min(); op.Type != "file" && min < 0 {
+		errs = append(errs, fmt.Sprintf("%s: Offset minus the amplitudes must be >= 0 (Gi can't go negative), is: %g", nm, min))
+	}
+	return errs
+}
+
+// Min returns the lowest value the waveform can reach (other than for file)
+func (op *OscParams) Min() float64 {
+	return op.Offset - math.Abs(op.Amp) - math.Abs(op.GammaAmp)
+}
+
+// Scaled returns a copy of the params with the amplitudes scaled by the given
+// factor and the given phase added, for a layer of an OscGroup
+func (op *OscParams) Scaled(scale, phase float64) *OscParams {
+	lp := *op
+	lp.Amp *= scale
+	lp.GammaAmp *= scale
+	lp.Phase += phase
+	return &lp
+}
+
+// SineOsc is a sinusoidal (cosine) oscillation
+type SineOsc struct {
+	OscParams
+}
+
+func (so *SineOsc) Val(cyc int) float64 {
+	a := so.Freq*float64(cyc) + so.Phase
+	return so.Amp*math.Cos(a) + so.Offset
+}
+
+// SquareOsc is a square wave, high for the first half of each period (where the
+// cosine is >= 0) and low for the second
+type SquareOsc struct {
+	OscParams
+}
+
+func (so *SquareOsc) Val(cyc int) float64 {
+	a := so.Freq*float64(cyc) + so.Phase
+	if math.Cos(a) >= 0 {
+		return so.Offset + so.Amp
+	}
+	return so.Offset - so.Amp
+}
+
+// SawOsc is a rising sawtooth, from low to high over each period
+type SawOsc struct {
+	OscParams
+}
+
+func (so *SawOsc) Val(cyc int) float64 {
+	a := (so.Freq*float64(cyc) + so.Phase) / (2 * math.Pi)
+	return so.Offset + so.Amp*(2*(a-math.Floor(a))-1)
+}
+
+// ThetaGammaOsc is a theta rhythm with a gamma rhythm nested in it, whose amplitude
+// follows the theta phase: GammaAmp at the peak of theta, 0 at the trough
+type ThetaGammaOsc struct {
+	OscParams
+}
+
+func (tg *ThetaGammaOsc) Val(cyc int) float64 {
+	th := math.Cos(tg.Freq*float64(cyc) + tg.Phase)
+	gm := math.Cos(tg.GammaFreq * float64(cyc))
+	return tg.Offset + tg.Amp*th + tg.GammaAmp*0.5*(1+th)*gm
+}
+
+// PinkOscRows is the number of octaves of white noise summed in PinkOsc
+const PinkOscRows = 12
+
+// PinkOsc is pink (1/f) noise, from the Voss-McCartney algorithm: the sum of
+// PinkOscRows white noise values, each updated half as often as the one before.
+// The values are generated in order from the seed, so Val is the same for a given
+// cycle however the sleep trial got there (e.g., when resuming from a checkpoint).
+type PinkOsc struct {
+	OscParams
+	Rnd  *rand.Rand
+	Rows [PinkOscRows]float64
+	Vals []float64
+}
+
+// NewPinkOsc returns a new PinkOsc that generates its noise from the given seed
+func NewPinkOsc(op *OscParams, seed int64) *PinkOsc {
+	po := &PinkOsc{OscParams: *op, Rnd: rand.New(rand.NewSource(seed))}
+	for i := range po.Rows {
+		po.Rows[i] = 2*po.Rnd.Float64() - 1
+	}
+	return po
+}
+
+func (po *PinkOsc) Val(cyc int) float64 {
+	for len(po.Vals) <= cyc {
+		n := len(po.Vals) + 1
+		sum := 0.0
+		for i := range po.Rows {
+			if n%(1<<uint(i)) == 0 {
+				po.Rows[i] = 2*po.Rnd.Float64() - 1
+			}
+			sum += po.Rows[i]
+		}
+		po.Vals = append(po.Vals, sum/PinkOscRows)
+	}
+	return po.Offset + po.Amp*po.Vals[cyc]
+}
+
+// FileOsc is a waveform loaded from a file, which repeats if the sleep trial is
+// longer than the file
+type FileOsc struct {
+	OscParams
+	Vals []float64
+}
+
+// OpenFileOsc returns a new FileOsc with the waveform in the params' File
+func OpenFileOsc(op *OscParams) (*FileOsc, error) {
+	b, err := ioutil.ReadFile(op.File)
+	if err != nil {
+		return nil, err
+	}
+	fo := &FileOsc{OscParams: *op}
+	for i, ln := range strings.Split(string(b), "\n") {
+		fld := strings.TrimSpace(strings.Split(ln, "\t")[0])
+		if fld == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(fld, 64)
+		if err != nil {
+			if len(fo.Vals) == 0 { // column header
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: %v", op.File, i+1, err)
+		}
+		fo.Vals = append(fo.Vals, v)
+	}
+	if len(fo.Vals) == 0 {
+		return nil, fmt.Errorf("%s: no values", op.File)
+	}
+	return fo, nil
+}
+
+func (fo *FileOsc) Val(cyc int) float64 {
+	return fo.Offset + fo.Amp*fo.Vals[cyc%len(fo.Vals)]
+}
+
+// OscGroup is a group of layers that get the same inhibitory oscillation during
+// sleep, as a multiplier on each layer's Gi from before sleep.  Each layer can
+// scale the amplitude of the oscillation, and offset its phase.
+type OscGroup struct {
+	Name     string             `desc:"name of the group -- its waveform is logged in the <Name>Osc column of the SlpCycLog"`
+	Osc      OscParams          `view:"inline" desc:"the oscillation of the group"`
+	Layers   []string           `desc:"names of the layers in the group -- a layer can only be in one group, and layers that aren't in any keep their Gi"`
+	AmpScale map[string]float64 `desc:"factor on the amplitudes of the oscillation for a layer, by layer name -- 1 for layers that aren't listed"`
+	Phase    map[string]float64 `desc:"offset in phase of the oscillation for a layer, in radians, by layer name -- 0 for layers that aren't listed (unused for pink and file)"`
+}
+
+// LayerOsc returns the params of the oscillation of the given layer of the group
+func (og *OscGroup) LayerOsc(lnm string) *OscParams {
+	scale, ok := og.AmpScale[lnm]
+	if !ok {
+		scale = 1
+	}
+	return og.Osc.Scaled(scale, og.Phase[lnm])
+}
+
+// ValidateOsc returns a description of each problem with the oscillation of the
+// group, including as scaled for each of its layers, prefixed with nm
+func (og *OscGroup) ValidateOsc(nm string) []string {
+	errs := og.Osc.Validate(nm)
+	if og.Osc.Type == "file" || og.Osc.Min() < 0 { // already reported
+		return errs
+	}
+	for _, lnm := range og.Layers {
+		if lp := og.LayerOsc(lnm); lp.Min() < 0 {
+			errs = append(errs, fmt.Sprintf("%s: Offset minus the amplitudes scaled for %s must be >= 0 (Gi can't go negative), is: %g", nm, lnm, lp.Min()))
+		}
+	}
+	return errs
+}
+
+// OscGroups are the layer groups of the sleep inhibitory oscillations
+type OscGroups []OscGroup
+
+// UnmarshalJSON replaces the groups with those in the JSON, rather than decoding
+// each one on top of the group that was at the same position, so that the groups
+// in a config file never pick up fields of the default groups.  Unknown fields
+// are an error, as for the rest of the config (see OpenExptConfig).
+func (ogs *OscGroups) UnmarshalJSON(b []byte) error {
+	var gs []OscGroup
+	if err := DecodeStrict(b, &gs); err != nil {
+		return err
+	}
+	*ogs = gs
+	return nil
+}
+
+// DecodeStrict decodes the JSON into v, with unknown fields an error
+func DecodeStrict(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// Group returns the group with the given name, or nil if there is none
+func (ogs OscGroups) Group(nm string) *OscGroup {
+	for i := range ogs {
+		if ogs[i].Name == nm {
+			return &ogs[i]
+		}
+	}
+	return nil
+}
+
+// Names returns the names of the groups, in order
+func (ogs OscGroups) Names() []string {
+	nms := make([]string, len(ogs))
+	for i := range ogs {
+		nms[i] = ogs[i].Name
+	}
+	return nms
+}
+
+// Validate returns a description of each problem with the groups, checking
+// their layers against the given layer names
+func (ogs OscGroups) Validate(lays []string) []string {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	gnms := make(map[string]bool)
+	lgps := make(map[string]string)
+	for i := range ogs {
+		og := &ogs[i]
+		nm := fmt.Sprintf("Slp.OscGroups[%d]", i)
+		if og.Name == "" {
+			bad("%s.Name must be set", nm)
+		} else if gnms[og.Name] {
+			bad("%s.Name %q is used by another group", nm, og.Name)
+		}
+		gnms[og.Name] = true
+		errs = append(errs, og.ValidateOsc(nm+".Osc")...)
+		for _, lnm := range og.Layers {
+			if !HasName(lays, lnm) {
+				bad("%s.Layers: %q is not a layer of the network", nm, lnm)
+			}
+			if gp, has := lgps[lnm]; has {
+				bad("%s.Layers: %q is already in group %q", nm, lnm, gp)
+			}
+			lgps[lnm] = og.Name
+		}
+		for lnm := range og.AmpScale {
+			if !HasName(og.Layers, lnm) {
+				bad("%s.AmpScale: %q is not one of the group's Layers", nm, lnm)
+			}
+		}
+		for lnm := range og.Phase {
+			if !HasName(og.Layers, lnm) {
+				bad("%s.Phase: %q is not one of the group's Layers", nm, lnm)
+			}
+		}
+	}
+	return errs
+}
+
+// LayerOsc is the inhibitory oscillation of one layer during sleep
+type LayerOsc struct {
+	Layer *leabra.Layer
+	Osc   Oscillator
+}
+
+// SlpOscillators returns a new oscillator for each of the given groups, in order,
+// and one for each layer in them, for a sleep stage (see StageOscGroups).  A layer
+// with the group's own amplitude and phase shares the group's oscillator.  Pink
+// noise is seeded from the SlpOsc stream and the group name, so each group gets
+// its own noise, the same in every trial and for every layer of the group.
+func (ss *Sim) SlpOscillators(ogs OscGroups) ([]Oscillator, []LayerOsc, error) {
+	oscs := make([]Oscillator, len(ogs))
+	var lyoscs []LayerOsc
+	for i := range ogs {
+		og := &ogs[i]
+		seed := DeriveSeed(ss.RunSeeds["SlpOsc"], 0, og.Name)
+		osc, err := NewOscillator(&og.Osc, seed)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s oscillation: %v", og.Name, err)
+		}
+		oscs[i] = osc
+		for _, lnm := range og.Layers {
+			ly, ok := ss.Net.LayerByName(lnm).(leabra.LeabraLayer)
+			if !ok {
+				return nil, nil, fmt.Errorf("%s oscillation: no layer named %q", og.Name, lnm)
+			}
+			lo := LayerOsc{Layer: ly.AsLeabra(), Osc: osc}
+			if lp := og.LayerOsc(lnm); *lp != og.Osc {
+				if lo.Osc, err = NewOscillator(lp, seed); err != nil {
+					return nil, nil, fmt.Errorf("%s oscillation of %s: %v", og.Name, lnm, err)
+				}
+			}
+			lyoscs = append(lyoscs, lo)
+		}
+	}
+	return oscs, lyoscs, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// baseOsc is the inhibitory oscillation from before the oscillation types: a
+// cosine with amplitude amp and angular frequency freq around offset
+func baseOsc(cyc int, freq, amp, offset, phase float64) float64 {
+	return amp*math.Cos(freq*float64(cyc)+phase) + offset
+}
+
+func TestOscVal(t *testing.T) {
+	const tol = 1e-12
+	tests := []struct {
+		name string
+		op   OscParams
+		want func(cyc int) float64
+	}{
+		{"sine low", OscParams{Type: "sine", Freq: 0.1, Amp: 1.0 / 80, Offset: 0.99}, func(c int) float64 {
+			return baseOsc(c, 0.1, 1.0/80, 0.99, 0)
+		}},
+		{"sine high", OscParams{Type: "sine", Freq: 0.1, Amp: 1.0 / 30, Offset: 0.99}, func(c int) float64 {
+			return baseOsc(c, 0.1, 1.0/30, 0.99, 0)
+		}},
+		{"sine phase", OscParams{Type: "sine", Freq: 0.05, Amp: 0.02, Offset: 1, Phase: 1.5}, func(c int) float64 {
+			return baseOsc(c, 0.05, 0.02, 1, 1.5)
+		}},
+		{"square", OscParams{Type: "square", Freq: 0.1, Amp: 0.02, Offset: 1}, func(c int) float64 {
+			if math.Cos(0.1*float64(c)) >= 0 {
+				return 1.02
+			}
+			return 0.98
+		}},
+		{"saw", OscParams{Type: "saw", Freq: 2 * math.Pi / 40, Amp: 0.02, Offset: 1}, func(c int) float64 {
+			return 1 + 0.02*(2*float64(c%40)/40-1)
+		}},
+		{"thetagamma no gamma", OscParams{Type: "thetagamma", Freq: 0.1, Amp: 0.02, Offset: 1, GammaFreq: 1}, func(c int) float64 {
+			return baseOsc(c, 0.1, 0.02, 1, 0)
+		}},
+		{"thetagamma", OscParams{Type: "thetagamma", Freq: 0.1, Amp: 0.02, Offset: 1, GammaFreq: 1, GammaAmp: 0.01}, func(c int) float64 {
+			th := math.Cos(0.1 * float64(c))
+			return 1 + 0.02*th + 0.01*0.5*(1+th)*math.Cos(float64(c))
+		}},
+	}
+	for _, tt := range tests {
+		osc, err := NewOscillator(&tt.op, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for cyc := 0; cyc < 500; cyc++ {
+			// saw is checked away from its jumps, where rounding can put it on either side
+			if tt.op.Type == "saw" && cyc%40 == 0 {
+				continue
+			}
+			if got, want := osc.Val(cyc), tt.want(cyc); math.Abs(got-want) > tol {
+				t.Errorf("%s: Val(%d) = %g, want %g", tt.name, cyc, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestPinkOsc(t *testing.T) {
+	op := &OscParams{Type: "pink", Amp: 0.02, Offset: 1}
+	fwd := NewPinkOsc(op, 5)
+	jump := NewPinkOsc(op, 5)
+	other := NewPinkOsc(op, 6)
+	jump.Val(999) // generates them all at once, as when resuming partway
+	same := true
+	for cyc := 0; cyc < 1000; cyc++ {
+		v := fwd.Val(cyc)
+		if vj := jump.Val(cyc); vj != v {
+			t.Fatalf("Val(%d) = %g in order, %g after jumping ahead", cyc, v, vj)
+		}
+		if v < op.Offset-op.Amp || v > op.Offset+op.Amp {
+			t.Errorf("Val(%d) = %g, out of range", cyc, v)
+		}
+		if other.Val(cyc) != v {
+			same = false
+		}
+	}
+	if same {
+		t.Errorf("different seeds give the same noise")
+	}
+}
+
+func TestFileOsc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fnm := filepath.Join(dir, "osc.tsv")
+	if err := ioutil.WriteFile(fnm, []byte("Val\tx\n0.5\t9\n-1\t9\n\n1\t9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	osc, err := NewOscillator(&OscParams{Type: "file", File: fnm, Amp: 0.1, Offset: 1}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cyc, want := range []float64{1.05, 0.9, 1.1, 1.05, 0.9, 1.1, 1.05} {
+		if got := osc.Val(cyc); math.Abs(got-want) > 1e-12 {
+			t.Errorf("Val(%d) = %g, want %g", cyc, got, want)
+		}
+	}
+
+	if err := ioutil.WriteFile(fnm, []byte("1\nx\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewOscillator(&OscParams{Type: "file", File: fnm}, 0); err == nil {
+		t.Errorf("no error for a bad value in the file")
+	}
+}
+
+func TestOscValidate(t *testing.T) {
+	tests := []struct {
+		op   OscParams
+		nerr int
+	}{
+		{OscParams{Type: "sine", Freq: 0.1, Amp: 0.01, Offset: 0.99}, 0},
+		{OscParams{Type: "sine", Freq: 0, Amp: 0.01, Offset: 0.99}, 1},
+		{OscParams{Type: "sine", Freq: 0.1, Amp: 2, Offset: 0.99}, 1},
+		{OscParams{Type: "thetagamma", Freq: 0.1, Amp: 0.01, Offset: 0.99}, 1},
+		{OscParams{Type: "pink", Amp: 0.01, Offset: 0.99}, 0},
+		{OscParams{Type: "cosine", Freq: 0.1, Offset: 0.99}, 1},
+	}
+	for _, tt := range tests {
+		if errs := tt.op.Validate("Osc"); len(errs) != tt.nerr {
+			t.Errorf("%+v: Validate = %q, want %d errors", tt.op, errs, tt.nerr)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// SlpPhaseEvt is the plus / minus phase pair that is underway during sleep --
+// the unit of sleep learning, which is logged in the SlpPhaseLog once it completes
+type SlpPhaseEvt struct {
+	Start    int     `desc:"cycle of the sleep trial that the plus phase started at"`
+	PlusN    int     `desc:"number of cycles in the plus phase, once it has ended"`
+	EntrySim float64 `desc:"AvgLaySim at the start of the plus phase"`
+	AbsDWt   float64 `desc:"sum of the |DWt| of the synapses from the learning of the pair so far"`
+}
+
+// ActSum adds the current activation of each neuron to the given sums, by layer,
+// starting them over if init -- for the mean plus and minus phase activations
+func (ss *Sim) ActSum(sums *[][]float32, init bool) {
+	if len(*sums) != len(ss.Net.Layers) {
+		*sums = make([][]float32, len(ss.Net.Layers))
+	}
+	for li, lyi := range ss.Net.Layers {
+		ly := lyi.(leabra.LeabraLayer).AsLeabra()
+		if len((*sums)[li]) != len(ly.Neurons) {
+			(*sums)[li] = make([]float32, len(ly.Neurons))
+		}
+		for ni := range ly.Neurons {
+			if init {
+				(*sums)[li][ni] = 0
+			}
+			(*sums)[li][ni] += ly.Neurons[ni].Act
+		}
+	}
+}
+
+// StartPlusPhase is called at the first cycle of a sleep plus phase
+func (ss *Sim) StartPlusPhase(cyc int) {
+	ss.PhaseEvt = SlpPhaseEvt{Start: cyc, EntrySim: ss.AvgLaySim}
+	ss.ActSum(&ss.PlusActs, true)
+}
+
+// EndPlusPhase is called at the end of a sleep plus phase of the given number of
+// cycles, which is the first cycle of the minus phase, once its learning is done
+func (ss *Sim) EndPlusPhase(plusCnt int) {
+	ss.PhaseEvt.PlusN = plusCnt
+	ss.PhaseEvt.AbsDWt += ss.SumAbsDWt()
+	ss.ActSum(&ss.MinusActs, true)
+}
+
+// EndMinusPhase is called at the end of a sleep minus phase of the given number of
+// cycles, at the given cycle, once its learning is done, and logs the completed
+// plus / minus pair in the SlpPhaseLog
+func (ss *Sim) EndMinusPhase(cyc, minusCnt int) {
+	ss.PhaseEvt.AbsDWt += ss.SumAbsDWt()
+	ss.LogSlpPhase(ss.SlpPhaseLog, cyc, minusCnt)
+}
+
+// SumAbsDWt returns the sum of the |DWt| of the synapses of the prjns that learn
+// during sleep -- the weight changes that have been computed since the weights
+// were last updated, at the start of the cycle
+func (ss *Sim) SumAbsDWt() float64 {
+	sum := 0.0
+	for _, pp := range ss.SlpPlasts {
+		pj := pp.Prjn
+		for si := range pj.Syns {
+			sum += math.Abs(float64(pj.Syns[si].DWt))
+		}
+	}
+	return sum
+}
+
+// LogSlpPhase adds the plus / minus pair that just ended, at the given cycle, with
+// a minus phase of the given number of cycles, to the SlpPhaseLog
+func (ss *Sim) LogSlpPhase(dt *etable.Table, cyc, minusCnt int) {
+	ev := &ss.PhaseEvt
+	row := dt.Rows
+	dt.SetNumRows(row + 1)
+	dt.SetCellFloat("Run", row, float64(ss.TrainEnv.Run.Cur))
+	dt.SetCellFloat("Epoch", row, float64(ss.TrainEnv.Epoch.Cur))
+	dt.SetCellFloat("Bout", row, float64(ss.SlpBout+1))
+	dt.SetCellString("Stage", row, ss.SlpStage)
+	dt.SetCellFloat("Start", row, float64(ev.Start))
+	dt.SetCellFloat("End", row, float64(cyc))
+	dt.SetCellFloat("PlusDur", row, float64(ev.PlusN))
+	dt.SetCellFloat("MinusDur", row, float64(minusCnt))
+	dt.SetCellFloat("EntrySim", row, ev.EntrySim)
+	dt.SetCellFloat("ExitSim", row, ss.AvgLaySim)
+	dt.SetCellFloat("AbsDWt", row, ev.AbsDWt)
+	for li, ly := range ss.Net.Layers {
+		dact := math.NaN()
+		if li < len(ss.PlusActs) && li < len(ss.MinusActs) && ev.PlusN > 0 && minusCnt > 0 {
+			sum := 0.0
+			for ni, ps := range ss.PlusActs[li] {
+				sum += float64(ps)/float64(ev.PlusN) - float64(ss.MinusActs[li][ni])/float64(minusCnt)
+			}
+			dact = sum / float64(len(ss.PlusActs[li]))
+		}
+		dt.SetCellFloat(ly.Name()+" dAct", row, dact)
+	}
+
+	WriteLogRow(ss.SlpPhaseFile, dt, row)
+}
+
+// ConfigSlpPhaseLog configures the SlpPhaseLog, with a row per completed plus /
+// minus phase pair of sleep in the run
+func (ss *Sim) ConfigSlpPhaseLog(dt *etable.Table) {
+	dt.SetMetaData("name", "SlpPhaseLog")
+	dt.SetMetaData("desc", "Plus / minus phase pairs of sleep -- the unit of sleep learning")
+	dt.SetMetaData("read-only", "true")
+	dt.SetMetaData("precision", strconv.Itoa(LogPrec))
+
+	sch := etable.Schema{
+		{"Run", etensor.INT64, nil, nil},
+		{"Epoch", etensor.INT64, nil, nil},
+		{"Bout", etensor.INT64, nil, nil},
+		{"Stage", etensor.STRING, nil, nil},
+		{"Start", etensor.INT64, nil, nil},
+		{"End", etensor.INT64, nil, nil},
+		{"PlusDur", etensor.INT64, nil, nil},
+		{"MinusDur", etensor.INT64, nil, nil},
+		{"EntrySim", etensor.FLOAT64, nil, nil},
+		{"ExitSim", etensor.FLOAT64, nil, nil},
+		{"AbsDWt", etensor.FLOAT64, nil, nil},
+	}
+	for _, ly := range ss.Net.Layers {
+		sch = append(sch, etable.Column{ly.Name() + " dAct", etensor.FLOAT64, nil, nil})
+	}
+	dt.SetFromSchema(sch, 0)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/emer/etable/etable"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// TestSlpPhaseLog goes through a plus / minus phase pair of 5 cycles each, with
+// weight changes in both, and checks the row it logs
+func TestSlpPhaseLog(t *testing.T) {
+	net, pj := newTestNet(t)
+	ss := &Sim{Net: net, SlpPhaseLog: &etable.Table{}}
+	ss.SlpPlasts = []*PrjnPlasticity{{Prjn: pj, Plasticity: SlpRuleParams{Rule: "chl"}}}
+	ss.ConfigSlpPhaseLog(ss.SlpPhaseLog)
+	setActs := func(act float32) {
+		for _, lyi := range net.Layers {
+			ly := lyi.(*leabra.Layer)
+			for ni := range ly.Neurons {
+				ly.Neurons[ni].Act = act
+			}
+		}
+	}
+	setDWt := func(dwt float32) {
+		for si := range pj.Syns {
+			pj.Syns[si].DWt = dwt * float32(1-2*(si%2)) // half of them down
+		}
+	}
+
+	ss.AvgLaySim = 0.9
+	setActs(0.8)
+	ss.StartPlusPhase(10)
+	for c := 1; c < 5; c++ {
+		ss.ActSum(&ss.PlusActs, false)
+	}
+	setActs(0.3)
+	setDWt(0.01)
+	ss.EndPlusPhase(5)
+	for c := 1; c < 5; c++ {
+		ss.ActSum(&ss.MinusActs, false)
+	}
+	setDWt(0.02)
+	ss.AvgLaySim = 0.4
+	ss.EndMinusPhase(20, 5)
+
+	dt := ss.SlpPhaseLog
+	if dt.Rows != 1 {
+		t.Fatalf("%d rows, want 1", dt.Rows)
+	}
+	want := map[string]float64{"Start": 10, "End": 20, "PlusDur": 5, "MinusDur": 5, "EntrySim": 0.9, "ExitSim": 0.4,
+		"AbsDWt": 6 * (0.01 + 0.02), "A dAct": 0.5, "B dAct": 0.5}
+	for col, w := range want {
+		if got := dt.CellFloat(col, 0); math.Abs(got-w) > 1e-6 {
+			t.Errorf("%s = %g, want %g", col, got, w)
+		}
+	}
+}
+
+func TestSumAbsDWt(t *testing.T) {
+	net, pj := newTestNet(t)
+	ss := &Sim{Net: net}
+	for si := range pj.Syns {
+		pj.Syns[si].DWt = -0.1
+	}
+	if got := ss.SumAbsDWt(); got != 0 {
+		t.Errorf("SumAbsDWt = %g of no learning prjns, want 0", got)
+	}
+	ss.SlpPlasts = []*PrjnPlasticity{{Prjn: pj}}
+	if got := ss.SumAbsDWt(); math.Abs(got-0.6) > 1e-6 {
+		t.Errorf("SumAbsDWt = %g, want 0.6", got)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/emer/emergent/params"
+	"github.com/goki/mat32"
+	"github.com/schapirolab/leabra-sleep/hip"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// SlpRules are the learning rules of the prjns during sleep (see Slp.Plasticity):
+// chl = the contrast between the plus and minus phases (hip.CHLPrjn.SlpDWt);
+// hebb = Hebbian learning on the stable plus phases; bcm = BCM-style learning on
+// the plus phases, with a sliding threshold; unlearn = anti-Hebbian "unlearning"
+// (Crick & Mitchison) of the minus phases
+var SlpRules = []string{"chl", "hebb", "bcm", "unlearn"}
+
+// PlasticityParams are the settings of learning during sleep
+type PlasticityParams struct {
+	Rule   string  `def:"chl" desc:"learning rule of every prjn during sleep -- the default for every prjn, which the Plasticity params sheet can set for each layer (for all of its sending prjns) or prjn, e.g., {Sel: \"#CA3ToCA3\", Params: {\"Prjn.Plasticity.Rule\": \"hebb\"}}: chl = contrast of the plus and minus phases: ActPAvg - ActMAvg at the end of each minus phase; hebb = at the end of each plus phase, CPCA Hebbian learning of its co-activity: ActPAvg - y * Wt, where y is the mean plus-phase activation of the receiver; bcm = at the end of each plus phase, ActPAvg * (y - theta), with theta a running average of y (see BCMTau); unlearn = at the end of each minus phase, anti-Hebbian learning of its co-activity: -ActMAvg -- all with the Lrate, Norm and Momentum of the prjn, and soft weight bounding"`
+	BCMTau float32 `def:"20" min:"1" desc:"for bcm, time constant, in plus phases, of the sliding threshold of each receiving neuron: the running average of its mean plus-phase activation, which starts from its ActAvg at the start of each sleep trial"`
+}
+
+// Defaults sets the default plasticity params
+func (pp *PlasticityParams) Defaults() {
+	pp.Rule = "chl"
+	pp.BCMTau = 20
+}
+
+// Validate returns a description of each problem with the plasticity params
+func (pp *PlasticityParams) Validate() []string {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	if !HasName(SlpRules, pp.Rule) {
+		bad("Slp.Plasticity.Rule %q is not one of: %s", pp.Rule, strings.Join(SlpRules, ", "))
+	}
+	if math.IsNaN(float64(pp.BCMTau)) || pp.BCMTau < 1 {
+		bad("Slp.Plasticity.BCMTau must be >= 1, is: %g", pp.BCMTau)
+	}
+	return errs
+}
+
+// SlpRuleParams is the sleep learning rule of a prjn, which defaults to
+// Slp.Plasticity.Rule, and can be set for each layer or prjn in the Plasticity
+// sheet of the param sets
+type SlpRuleParams struct {
+	Rule string `desc:"learning rule of the prjn during sleep (see SlpRules)"`
+}
+
+// LayerPlasticity is the sleep learning rule of a layer, which is the default of
+// its sending prjns -- the target of the Layer selectors of the Plasticity sheet
+type LayerPlasticity struct {
+	Layer      *leabra.Layer
+	Plasticity SlpRuleParams
+}
+
+func (lp *LayerPlasticity) TypeName() string { return "Layer" }
+func (lp *LayerPlasticity) Class() string    { return lp.Layer.Class() }
+func (lp *LayerPlasticity) Name() string     { return lp.Layer.Name() }
+
+// PrjnPlasticity is the sleep learning rule of a prjn -- the target of the Prjn
+// selectors of the Plasticity sheet
+type PrjnPlasticity struct {
+	Prjn       *hip.CHLPrjn
+	Plasticity SlpRuleParams
+}
+
+func (pp *PrjnPlasticity) TypeName() string { return "Prjn" }
+func (pp *PrjnPlasticity) Class() string    { return pp.Prjn.Class() }
+func (pp *PrjnPlasticity) Name() string     { return pp.Prjn.Name() }
+
+// PrjnPlasticities returns the sleep learning rule of each prjn that learns during
+// sleep -- the sending prjns of each layer, as with SynDepPrjns -- from the given
+// sleep params and the Plasticity sheets of the Base and given param sets
+func (ss *Sim) PrjnPlasticities(sp *SleepParams, paramSet string, setMsg bool) ([]*PrjnPlasticity, error) {
+	setNms := []string{"Base"}
+	if paramSet != "" && paramSet != "Base" {
+		setNms = append(setNms, paramSet)
+	}
+	var shs []*params.Sheet
+	for _, nm := range setNms {
+		pset, err := ss.Params.SetByNameTry(nm)
+		if err != nil {
+			return nil, err
+		}
+		if sh, has := pset.Sheets["Plasticity"]; has {
+			shs = append(shs, sh)
+		}
+	}
+	apply := func(obj params.Styler) error {
+		for _, sh := range shs {
+			if _, err := sh.Apply(obj, setMsg); err != nil {
+				return fmt.Errorf("%s %s: %v", obj.TypeName(), obj.Name(), err)
+			}
+		}
+		return nil
+	}
+
+	lps := make(map[string]*LayerPlasticity, len(ss.Net.Layers))
+	for _, lyi := range ss.Net.Layers {
+		lp := &LayerPlasticity{Layer: lyi.(leabra.LeabraLayer).AsLeabra(), Plasticity: SlpRuleParams{Rule: sp.Plasticity.Rule}}
+		if err := apply(lp); err != nil {
+			return nil, err
+		}
+		lps[lp.Name()] = lp
+	}
+	pjs := ss.SynDepPrjns()
+	pps := make([]*PrjnPlasticity, len(pjs))
+	for i, pj := range pjs {
+		pps[i] = &PrjnPlasticity{Prjn: pj.(*hip.CHLPrjn), Plasticity: lps[pj.SendLay().Name()].Plasticity}
+		if err := apply(pps[i]); err != nil {
+			return nil, err
+		}
+	}
+	return pps, nil
+}
+
+// SlpRulesByPrjn returns the sleep learning rule of each prjn, by name, for the
+// run manifest -- nil if they can't be set from the param sets
+func (ss *Sim) SlpRulesByPrjn() map[string]string {
+	pps, err := ss.PrjnPlasticities(&ss.Slp, ss.ParamSet, false)
+	if err != nil {
+		return nil
+	}
+	rules := make(map[string]string, len(pps))
+	for _, pp := range pps {
+		rules[pp.Name()] = pp.Plasticity.Rule
+	}
+	return rules
+}
+
+// PlusDWt is called at the end of each sleep plus phase of the given number of
+// cycles, once the plus-phase co-activity of the synapses (ActPAvg) is set, and
+// computes the weight changes of the prjns with the hebb and bcm rules
+func (ss *Sim) PlusDWt(plusCnt int) {
+	if plusCnt == 0 || len(ss.PlusActs) != len(ss.Net.Layers) {
+		return
+	}
+	yp := make(map[string][]float32, len(ss.Net.Layers))
+	for li, lyi := range ss.Net.Layers {
+		acts := make([]float32, len(ss.PlusActs[li]))
+		for ni, s := range ss.PlusActs[li] {
+			acts[ni] = s / float32(plusCnt)
+		}
+		yp[lyi.Name()] = acts
+	}
+	for _, pp := range ss.SlpPlasts {
+		pj := pp.Prjn
+		if !pj.Learn.Learn {
+			continue
+		}
+		y := yp[pj.RecvLay().Name()]
+		switch pp.Plasticity.Rule {
+		case "hebb":
+			SlpSynDWt(pj, func(sy *leabra.Synapse, ri int32) float32 {
+				return sy.ActPAvg - y[ri]*sy.LWt
+			})
+		case "bcm":
+			thr := ss.BCMThrs(pj.RecvLay().Name())
+			SlpSynDWt(pj, func(sy *leabra.Synapse, ri int32) float32 {
+				return sy.ActPAvg * (y[ri] - thr[ri])
+			})
+		}
+	}
+
+	// the thresholds slide after the weight changes of the phase
+	dt := 1 / ss.Slp.Plasticity.BCMTau
+	for lnm, thr := range ss.BCMThr {
+		for ni := range thr {
+			thr[ni] += dt * (yp[lnm][ni] - thr[ni])
+		}
+	}
+}
+
+// MinusDWt is called at the end of each sleep minus phase, once the minus-phase
+// co-activity of the synapses (ActMAvg) is set, and computes the weight changes
+// of the prjns with the chl and unlearn rules
+func (ss *Sim) MinusDWt() {
+	for _, pp := range ss.SlpPlasts {
+		pj := pp.Prjn
+		switch pp.Plasticity.Rule {
+		case "chl":
+			pj.SlpDWt() // Weight changes occuring here
+		case "unlearn":
+			if !pj.Learn.Learn {
+				continue
+			}
+			SlpSynDWt(pj, func(sy *leabra.Synapse, ri int32) float32 {
+				return -sy.ActMAvg
+			})
+		}
+	}
+}
+
+// BCMThrs returns the sliding thresholds of the bcm rule of the neurons of the
+// given layer, starting them from their ActAvg if this is the first time in the
+// sleep trial
+func (ss *Sim) BCMThrs(lnm string) []float32 {
+	if ss.BCMThr == nil {
+		ss.BCMThr = make(map[string][]float32)
+	}
+	thr, has := ss.BCMThr[lnm]
+	if !has {
+		ly := ss.Net.LayerByName(lnm).(leabra.LeabraLayer).AsLeabra()
+		thr = make([]float32, len(ly.Neurons))
+		for ni := range ly.Neurons {
+			thr[ni] = ly.Neurons[ni].ActAvg
+		}
+		ss.BCMThr[lnm] = thr
+	}
+	return thr
+}
+
+// SlpSynDWt adds the weight change given by dwt, for each synapse of the prjn and
+// the index of its receiving neuron, to the DWt of the synapse, as in SlpDWtCHL:
+// soft bounded by the weight, with the Norm and Momentum of the prjn, times its Lrate
+func SlpSynDWt(pj *hip.CHLPrjn, dwt func(sy *leabra.Synapse, ri int32) float32) {
+	slay := pj.Send.(leabra.LeabraLayer).AsLeabra()
+	for si := range slay.Neurons {
+		nc := int(pj.SConN[si])
+		st := int(pj.SConIdxSt[si])
+		syns := pj.Syns[st : st+nc]
+		scons := pj.SConIdx[st : st+nc]
+		for ci := range syns {
+			sy := &syns[ci]
+			dw := dwt(sy, scons[ci])
+			if dw > 0 {
+				dw *= 1 - sy.LWt
+			} else {
+				dw *= sy.LWt
+			}
+			norm := float32(1)
+			if pj.Learn.Norm.On {
+				norm = pj.Learn.Norm.NormFmAbsDWt(&sy.Norm, mat32.Abs(dw))
+			}
+			if pj.Learn.Momentum.On {
+				dw = norm * pj.Learn.Momentum.MomentFmDWt(&sy.Moment, dw)
+			} else {
+				dw *= norm
+			}
+			sy.DWt += pj.Learn.Lrate * dw
+		}
+		// aggregate max DWtNorm over sending synapses
+		if pj.Learn.Norm.On {
+			maxNorm := float32(0)
+			for ci := range syns {
+				if syns[ci].Norm > maxNorm {
+					maxNorm = syns[ci].Norm
+				}
+			}
+			for ci := range syns {
+				syns[ci].Norm = maxNorm
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// newPlastSim returns a sim with the network of newTestNet, whose one prjn learns
+// with the given sleep learning rule, without Norm or Momentum
+func newPlastSim(t *testing.T, rule string) *Sim {
+	net, pj := newTestNet(t)
+	pj.Learn.Norm.On = false
+	pj.Learn.Momentum.On = false
+	pj.Learn.Lrate = 0.1
+	ss := &Sim{Net: net}
+	ss.Slp.Plasticity.Defaults()
+	ss.SlpPlasts = []*PrjnPlasticity{{Prjn: pj, Plasticity: SlpRuleParams{Rule: rule}}}
+	return ss
+}
+
+// plusPhase runs PlusDWt at the end of a plus phase of 10 cycles, with the given
+// mean activations of the receiving layer B
+func plusPhase(ss *Sim, bacts []float32) {
+	ss.PlusActs = [][]float32{make([]float32, 3), make([]float32, len(bacts))}
+	for ni, act := range bacts {
+		ss.PlusActs[1][ni] = 10 * act
+	}
+	ss.PlusDWt(10)
+}
+
+func TestSlpSynDWt(t *testing.T) {
+	ss := newPlastSim(t, "chl")
+	pj := ss.SlpPlasts[0].Prjn
+	for si := range pj.Syns {
+		pj.Syns[si].LWt = 0.2
+		pj.Syns[si].DWt = 0
+	}
+	// up for receiver 0, down for receiver 1: soft bounded by 1 - LWt and LWt
+	for i := 0; i < 2; i++ {
+		SlpSynDWt(pj, func(sy *leabra.Synapse, ri int32) float32 {
+			return 1 - 2*float32(ri)
+		})
+	}
+	for si := range pj.Syns {
+		want := float32(2 * 0.1 * 0.8)
+		if pj.SConIdx[si] == 1 {
+			want = -2 * 0.1 * 0.2
+		}
+		if got := pj.Syns[si].DWt; math.Abs(float64(got-want)) > 1e-6 {
+			t.Errorf("syn %d to receiver %d: DWt = %g, want %g", si, pj.SConIdx[si], got, want)
+		}
+	}
+}
+
+// TestHebbDWt checks that the weights learn toward the co-activity of the plus
+// phase over the receiver's activation, ActPAvg / y, from either side
+func TestHebbDWt(t *testing.T) {
+	ss := newPlastSim(t, "hebb")
+	pj := ss.SlpPlasts[0].Prjn
+	lwts := []float32{0.2, 0.5, 0.8}
+	for si := range pj.Syns {
+		pj.Syns[si].ActPAvg = 0.3
+		pj.Syns[si].LWt = lwts[si%3]
+		pj.Syns[si].DWt = 0
+	}
+	plusPhase(ss, []float32{0.6, 0.6}) // ActPAvg / y = 0.5
+	for si := range pj.Syns {
+		dw := pj.Syns[si].DWt
+		switch lwt := pj.Syns[si].LWt; {
+		case lwt < 0.5 && dw <= 0, lwt > 0.5 && dw >= 0, lwt == 0.5 && math.Abs(float64(dw)) > 1e-7:
+			t.Errorf("LWt %g: DWt = %g, want toward 0.5", lwt, dw)
+		}
+	}
+}
+
+// TestBCMThreshold checks that the threshold of each receiver slides from its
+// ActAvg toward its plus-phase activation, with time constant BCMTau, and that
+// the weights learn up while the activation is above it
+func TestBCMThreshold(t *testing.T) {
+	ss := newPlastSim(t, "bcm")
+	ss.Slp.Plasticity.BCMTau = 4
+	pj := ss.SlpPlasts[0].Prjn
+	b := ss.Net.LayerByName("B").(*leabra.Layer)
+	for ni := range b.Neurons {
+		b.Neurons[ni].ActAvg = 0.2
+	}
+	for si := range pj.Syns {
+		pj.Syns[si].ActPAvg = 0.5
+		pj.Syns[si].DWt = 0
+	}
+	y := []float32{0.6, 0.2}
+	for n := 1; n <= 20; n++ {
+		plusPhase(ss, y)
+		for ni, thr := range ss.BCMThr["B"] {
+			want := y[ni] - (y[ni]-0.2)*float32(math.Pow(0.75, float64(n)))
+			if math.Abs(float64(thr-want)) > 1e-5 {
+				t.Fatalf("phase %d: threshold of B %d = %g, want %g", n, ni, thr, want)
+			}
+		}
+	}
+	for si := range pj.Syns {
+		dw := pj.Syns[si].DWt
+		if ri := pj.SConIdx[si]; (ri == 0 && dw <= 0) || (ri == 1 && dw != 0) {
+			t.Errorf("syn %d to receiver %d: DWt = %g, want > 0 for the receiver above its threshold, 0 for the one at it", si, ri, dw)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// PerLayers are the perceptual layers, whose activations are decoded into the
+// training item that is being replayed during sleep
+var PerLayers = []string{"F1", "F2", "F3", "F4", "F5", "ClassName", "CodeName"}
+
+// ReplayParams are the settings of the replay decoder.  Each replay event during
+// sleep -- each plus phase, optionally each stable period, and each sharp-wave
+// ripple (see Slp.Ripple) -- is decoded into the training item (row of TrainSat)
+// whose pattern over the perceptual layers is closest to their mean activations
+// over the event, and logged in the ReplayLog.
+type ReplayParams struct {
+	On     bool `def:"true" desc:"whether to decode replay events into the ReplayLog"`
+	Stable bool `desc:"also decode each stable period -- AvgLaySim at or above PlusThr for at least Slp.StableCycs cycles -- whether or not there is learning, rather than only the plus phases"`
+}
+
+// Defaults sets the default replay params
+func (rp *ReplayParams) Defaults() {
+	rp.On = true
+	rp.Stable = false
+}
+
+// ReplayItem is a training item that replay events are decoded into
+type ReplayItem struct {
+	Name string
+	Cat  int       `desc:"category of the item -- the active unit of its ClassName pattern, from 1"`
+	Pat  []float32 `desc:"pattern of the item over the perceptual layers, in the order of PerLayers"`
+}
+
+// ReplayEvent is a replay event that is underway during sleep
+type ReplayEvent struct {
+	Start int       `desc:"cycle of the sleep trial that the event started at"`
+	N     int       `desc:"number of cycles in the event so far -- 0 if there is no event underway"`
+	Sum   []float32 `desc:"sum over the event of the activations of the perceptual layers, in the order of PerLayers"`
+}
+
+// ReplayItems returns the items of TrainSat that replay events are decoded into,
+// once for each Name, in the order they first appear
+func (ss *Sim) ReplayItems() []ReplayItem {
+	dt := ss.TrainSat
+	var items []ReplayItem
+	has := make(map[string]bool)
+	for row := 0; row < dt.Rows; row++ {
+		nm := dt.CellString("Name", row)
+		if has[nm] {
+			continue
+		}
+		has[nm] = true
+		it := ReplayItem{Name: nm}
+		for _, lnm := range PerLayers {
+			tsr := dt.CellTensor(lnm, row)
+			for i := 0; i < tsr.Len(); i++ {
+				it.Pat = append(it.Pat, float32(tsr.FloatVal1D(i)))
+			}
+			if lnm == "ClassName" {
+				mx := 0.0
+				for i := 0; i < tsr.Len(); i++ {
+					if v := tsr.FloatVal1D(i); v > mx {
+						it.Cat, mx = i+1, v
+					}
+				}
+			}
+		}
+		items = append(items, it)
+	}
+	return items
+}
+
+// DecodeReplay returns the item whose pattern has the highest cosine with the
+// given activations, and that cosine -- the fidelity of the replay
+func DecodeReplay(items []ReplayItem, acts []float32) (*ReplayItem, float64) {
+	var best *ReplayItem
+	bfid := math.Inf(-1)
+	for i := range items {
+		it := &items[i]
+		if len(it.Pat) != len(acts) {
+			continue
+		}
+		var ab, aa, bb float64
+		for j, p := range it.Pat {
+			ab += float64(p) * float64(acts[j])
+			aa += float64(acts[j]) * float64(acts[j])
+			bb += float64(p) * float64(p)
+		}
+		fid := 0.0
+		if aa > 0 && bb > 0 {
+			fid = ab / math.Sqrt(aa*bb)
+		}
+		if fid > bfid {
+			best, bfid = it, fid
+		}
+	}
+	return best, bfid
+}
+
+// ReplayCyc is called at each cycle of sleep, once the plus and minus phases are
+// updated, to track the replay events, and decode and log each one that ends
+func (ss *Sim) ReplayCyc(cyc int) {
+	if !ss.Slp.Replay.On || ss.SlpCalib {
+		return
+	}
+	ss.TrackReplay(&ss.PlusEvt, "plus", ss.PlusPhase, cyc)
+	if ss.Slp.Replay.Stable {
+		ss.TrackReplay(&ss.StableEvt, "stable", ss.AvgLaySim >= ss.PlusThr, cyc)
+	}
+	if ss.Slp.Ripple.On {
+		ss.TrackReplay(&ss.RippleEvt, "ripple", ss.RippleLeft > 0, cyc)
+	}
+}
+
+// EndReplay ends any replay events that are underway at the end of a sleep trial
+func (ss *Sim) EndReplay(cyc int) {
+	if !ss.Slp.Replay.On || ss.SlpCalib {
+		return
+	}
+	ss.TrackReplay(&ss.PlusEvt, "plus", false, cyc)
+	ss.TrackReplay(&ss.StableEvt, "stable", false, cyc)
+	ss.TrackReplay(&ss.RippleEvt, "ripple", false, cyc)
+}
+
+// TrackReplay adds the current activations of the perceptual layers to the given
+// event if on, which starts it if it isn't already underway, or else ends it,
+// logging it if it is an event of the given type
+func (ss *Sim) TrackReplay(ev *ReplayEvent, typ string, on bool, cyc int) {
+	if !on {
+		if ev.N > 0 && (typ != "stable" || ev.N >= ss.Slp.StableCycs) {
+			ss.LogReplay(ss.ReplayLog, ev, typ)
+		}
+		ev.N = 0
+		return
+	}
+	if ev.N == 0 {
+		ev.Start = cyc
+		ev.Sum = ev.Sum[:0]
+	}
+	i := 0
+	for _, lnm := range PerLayers {
+		ly := ss.Net.LayerByName(lnm).(leabra.LeabraLayer).AsLeabra()
+		for ni := range ly.Neurons {
+			if i == len(ev.Sum) {
+				ev.Sum = append(ev.Sum, 0)
+			}
+			ev.Sum[i] += ly.Neurons[ni].Act
+			i++
+		}
+	}
+	ev.N++
+}
+
+// LogReplay decodes the given replay event, which has just ended, and adds it to
+// the ReplayLog
+func (ss *Sim) LogReplay(dt *etable.Table, ev *ReplayEvent, typ string) {
+	acts := make([]float32, len(ev.Sum))
+	for i, s := range ev.Sum {
+		acts[i] = s / float32(ev.N)
+	}
+	item, fid := DecodeReplay(ss.ReplayDecItems, acts)
+	if item == nil {
+		return
+	}
+
+	row := dt.Rows
+	dt.SetNumRows(row + 1)
+	dt.SetCellFloat("Run", row, float64(ss.TrainEnv.Run.Cur))
+	dt.SetCellFloat("Epoch", row, float64(ss.TrainEnv.Epoch.Cur))
+	dt.SetCellFloat("Bout", row, float64(ss.SlpBout+1))
+	dt.SetCellString("Type", row, typ)
+	dt.SetCellString("Stage", row, ss.SlpStage)
+	dt.SetCellFloat("Start", row, float64(ev.Start))
+	dt.SetCellFloat("Dur", row, float64(ev.N))
+	dt.SetCellString("Item", row, item.Name)
+	dt.SetCellFloat("Category", row, float64(item.Cat))
+	dt.SetCellFloat("Fidelity", row, fid)
+
+	WriteLogRow(ss.ReplayFile, dt, row)
+}
+
+// ConfigReplayLog configures the ReplayLog, with a row per replay event in the run
+func (ss *Sim) ConfigReplayLog(dt *etable.Table) {
+	dt.SetMetaData("name", "ReplayLog")
+	dt.SetMetaData("desc", "Replay events during sleep, decoded into the training item whose pattern best matches the perceptual layers")
+	dt.SetMetaData("read-only", "true")
+	dt.SetMetaData("precision", strconv.Itoa(LogPrec))
+
+	sch := etable.Schema{
+		{"Run", etensor.INT64, nil, nil},
+		{"Epoch", etensor.INT64, nil, nil},
+		{"Bout", etensor.INT64, nil, nil},
+		{"Type", etensor.STRING, nil, nil},
+		{"Stage", etensor.STRING, nil, nil},
+		{"Start", etensor.INT64, nil, nil},
+		{"Dur", etensor.INT64, nil, nil},
+		{"Item", etensor.STRING, nil, nil},
+		{"Category", etensor.INT64, nil, nil},
+		{"Fidelity", etensor.FLOAT64, nil, nil},
+	}
+	dt.SetFromSchema(sch, 0)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDecodeReplay(t *testing.T) {
+	items := []ReplayItem{
+		{Name: "A", Pat: []float32{1, 1, 0, 0, 0}},
+		{Name: "B", Pat: []float32{0, 1, 1, 0, 0}},
+		{Name: "C", Pat: []float32{0, 0, 0, 1, 1}},
+		{Name: "short", Pat: []float32{0, 1, 1}},
+	}
+	// noisy replay of B, summed over 4 cycles, as in a ReplayEvent
+	acts := []float32{0.4, 2.8, 3.6, 0.4, 0}
+	it, fid := DecodeReplay(items, acts)
+	if it == nil || it.Name != "B" {
+		t.Fatalf("decoded %v, want B", it)
+	}
+	if want := (2.8 + 3.6) / math.Sqrt(2*(0.16+2.8*2.8+3.6*3.6+0.16)); math.Abs(fid-want) > 1e-6 {
+		t.Errorf("fidelity = %g, want the cosine with B: %g", fid, want)
+	}
+
+	// with no activity, every item is as good as any other: the first one, with 0 fidelity
+	if it, fid := DecodeReplay(items, make([]float32, 5)); it == nil || it.Name != "A" || fid != 0 {
+		t.Errorf("no activity: decoded %v with fidelity %g, want A with 0", it, fid)
+	}
+	if it, _ := DecodeReplay(items, []float32{1, 1}); it != nil {
+		t.Errorf("decoded %s from activations that match no item in size", it.Name)
+	}
+}
+
+// TestReplayItems checks the items decoded from the training patterns of the sim:
+// one per name, each decoded from its own pattern
+func TestReplayItems(t *testing.T) {
+	ss := newTestSim(t, 1)
+	items := ss.ReplayItems()
+	names := make(map[string]bool)
+	for row := 0; row < ss.TrainSat.Rows; row++ {
+		names[ss.TrainSat.CellString("Name", row)] = true
+	}
+	if len(items) != len(names) {
+		t.Fatalf("%d items, want one per name: %d", len(items), len(names))
+	}
+	npat := 0
+	for _, lnm := range PerLayers {
+		npat += ss.Net.LayerByName(lnm).Shape().Len()
+	}
+	for i := range items {
+		it := &items[i]
+		if len(it.Pat) != npat || it.Cat < 1 {
+			t.Errorf("item %s: %d units in its pattern, category %d -- want %d, and a category from 1", it.Name, len(it.Pat), it.Cat, npat)
+			continue
+		}
+		if dit, fid := DecodeReplay(items, it.Pat); math.Abs(fid-1) > 1e-6 {
+			t.Errorf("item %s decoded as %s with fidelity %g, want 1", it.Name, dit.Name, fid)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/schapirolab/leabra-sleep/hip"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// RippleModes are the ways a sharp-wave ripple bursts the CA3 recurrent
+// activity (see Slp.Ripple)
+var RippleModes = []string{"wtscale", "gi"}
+
+// RippleParams are the settings of the sharp-wave ripple generator during sleep.
+// Replay otherwise emerges from synaptic depression and the oscillations alone --
+// with the generator on, each time the oscillation of Group passes through Phase,
+// CA3 gets a brief, high-gain recurrent burst, by raising the WtScale.Abs of
+// CA3 -> CA3 or lowering the Gi of CA3.  Each ripple is decoded and logged in the
+// ReplayLog as a ripple event, so that its timing can be set against the
+// oscillations in the SlpCycLog.
+type RippleParams struct {
+	On       bool     `desc:"whether to generate ripples during sleep"`
+	Group    string   `def:"High" desc:"oscillation group (see Slp.OscGroups) whose phase the ripples are coupled to -- its oscillation must be periodic (sine, square, saw or thetagamma) in every stage the ripples are in"`
+	Phase    float64  `def:"3.14159" desc:"phase of the oscillation of Group at which each ripple starts, in radians (Freq * cycle + Phase of the group, mod 2 pi): 0 = the peak of the inhibition, pi = its trough -- the phase is that of the oscillation in the SlpCycLog, whether or not InhibOscil is on"`
+	Dur      int      `def:"10" min:"1" desc:"number of cycles in each ripple"`
+	Mode     string   `def:"wtscale" desc:"how the ripple bursts CA3: wtscale = the WtScale.Abs of CA3 -> CA3 is multiplied by Gain; gi = the Inhib.Layer.Gi of CA3 is multiplied by GiFactor"`
+	Gain     float32  `def:"2" min:"0" desc:"for wtscale, factor on the WtScale.Abs of CA3 -> CA3 (see CA3RecAbs) during a ripple"`
+	GiFactor float32  `def:"0.8" min:"0" desc:"for gi, factor on the Inhib.Layer.Gi of CA3 during a ripple, on top of its oscillation"`
+	Stages   []string `desc:"stages of sleep (see Slp.Stages) during which there are ripples -- all of them if empty"`
+}
+
+// Defaults sets the default ripple params
+func (rp *RippleParams) Defaults() {
+	rp.On = false
+	rp.Group = "High"
+	rp.Phase = math.Pi
+	rp.Dur = 10
+	rp.Mode = "wtscale"
+	rp.Gain = 2
+	rp.GiFactor = 0.8
+	rp.Stages = nil
+}
+
+// Validate returns a description of each problem with the ripple params, given
+// the rest of the sleep params, for the oscillation groups and the stages
+func (rp *RippleParams) Validate(sp *SleepParams) []string {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	if !HasName(RippleModes, rp.Mode) {
+		bad("Slp.Ripple.Mode %q is not one of: %s", rp.Mode, strings.Join(RippleModes, ", "))
+	}
+	if math.IsNaN(rp.Phase) || math.IsInf(rp.Phase, 0) {
+		bad("Slp.Ripple.Phase must be a number of radians, is: %g", rp.Phase)
+	}
+	if rp.Dur <= 0 {
+		bad("Slp.Ripple.Dur must be > 0, is: %d", rp.Dur)
+	}
+	if math.IsNaN(float64(rp.Gain)) || rp.Gain < 0 {
+		bad("Slp.Ripple.Gain must be >= 0, is: %g", rp.Gain)
+	}
+	if math.IsNaN(float64(rp.GiFactor)) || rp.GiFactor < 0 {
+		bad("Slp.Ripple.GiFactor must be >= 0, is: %g", rp.GiFactor)
+	}
+	stages := sp.StageNames()
+	for _, snm := range rp.Stages {
+		if !HasName(stages, snm) {
+			bad("Slp.Ripple.Stages: %q is not one of the stages of sleep: %s", snm, strings.Join(stages, ", "))
+		}
+	}
+	og := sp.OscGroups.Group(rp.Group)
+	if og == nil {
+		bad("Slp.Ripple.Group %q is not one of the Slp.OscGroups: %s", rp.Group, strings.Join(sp.OscGroups.Names(), ", "))
+		return errs
+	}
+	if !rp.On { // the phase of the group only matters if there are ripples
+		return errs
+	}
+	for _, st := range sp.AllStages() {
+		if len(rp.Stages) > 0 && !HasName(rp.Stages, st.Name) {
+			continue
+		}
+		op := og.Osc
+		if sop, has := st.Osc[rp.Group]; has {
+			op = sop
+		}
+		if !PeriodicOsc(&op) {
+			bad("Slp.Ripple.Group: the %s oscillation of %q during stage %q has no phase for the ripples to be coupled to", op.Type, rp.Group, st.Name)
+		}
+	}
+	return errs
+}
+
+// PeriodicOsc returns true if the oscillation has a phase -- Freq * cycle + Phase
+func PeriodicOsc(op *OscParams) bool {
+	switch op.Type {
+	case "sine", "square", "saw", "thetagamma":
+		return true
+	}
+	return false
+}
+
+// Due returns true if a ripple starts at the given cycle of a sleep trial, in
+// the given stage, with the given oscillation of Group: the first cycle at or
+// past Phase in each period of the oscillation -- where the number of periods
+// it has been through since Phase goes up, which can't be counted twice
+func (rp *RippleParams) Due(cyc int, stage string, op *OscParams) bool {
+	if !rp.On || !PeriodicOsc(op) || (len(rp.Stages) > 0 && !HasName(rp.Stages, stage)) {
+		return false
+	}
+	periods := func(c int) float64 {
+		return math.Floor((op.Freq*float64(c) + op.Phase - rp.Phase) / (2 * math.Pi))
+	}
+	return periods(cyc) > periods(cyc-1)
+}
+
+// StageCA3RecAbs returns the WtScale.Abs of CA3 -> CA3 during the given stage
+func (sp *SleepParams) StageCA3RecAbs(st *SleepStage) float32 {
+	if st.CA3RecAbs != nil {
+		return *st.CA3RecAbs
+	}
+	return sp.CA3RecAbs
+}
+
+// RippleCyc is called at each cycle of sleep, before the network cycles, and
+// starts or continues a ripple in the given stage -- not during the calibration
+// segment.  RippleLeft is the number of cycles left in the current ripple,
+// including this one.
+func (ss *Sim) RippleCyc(cyc int, st *SleepStage) {
+	rp := &ss.Slp.Ripple
+	if !rp.On || ss.SlpCalib {
+		return
+	}
+	if ss.RippleLeft > 0 {
+		ss.RippleLeft--
+	}
+	if ss.RippleLeft == 0 {
+		if og := ss.StageOscGroups(st).Group(rp.Group); og != nil && rp.Due(cyc, st.Name, &og.Osc) {
+			ss.RippleLeft = rp.Dur
+			ss.RippleN++
+		}
+	}
+	ss.SetRippleGain(st, ss.RippleLeft > 0)
+}
+
+// SetRippleGain sets the CA3 recurrent gain of the given stage, bursting for a
+// ripple if on.  It can be called every cycle, as it only changes the scaling of
+// the network when it differs from the gain it should have.
+func (ss *Sim) SetRippleGain(st *SleepStage, on bool) {
+	rp := &ss.Slp.Ripple
+	ca3 := ss.Net.LayerByName("CA3").(leabra.LeabraLayer).AsLeabra()
+	switch rp.Mode {
+	case "wtscale":
+		abs := ss.Slp.StageCA3RecAbs(st)
+		if on {
+			abs *= rp.Gain
+		}
+		pj := ca3.RcvPrjns.SendName("CA3").(*hip.CHLPrjn)
+		if pj.WtScale.Abs != abs {
+			pj.WtScale.Abs = abs
+			ss.Net.GScaleFmAvgAct() // update computed scaling factors
+			ss.Net.InitGInc()       // scaling params change, so need to recompute all netins
+		}
+	case "gi":
+		gi := ca3.Inhib.Layer.Gi // with the oscillation of the last cycle, if any
+		if !ss.InhibOscil {
+			gi = ss.SlpWakeGi[ca3.Name()]
+		}
+		if on {
+			gi *= rp.GiFactor
+		}
+		ca3.Inhib.Layer.Gi = gi
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRippleDue(t *testing.T) {
+	sine := OscParams{Type: "sine", Freq: 0.1, Amp: 1.0 / 30, Offset: 0.99}
+	tests := []struct {
+		name  string
+		phase float64
+		op    OscParams
+		want  []int // cycles a ripple starts at in 0..250
+	}{
+		{"trough", math.Pi, sine, []int{32, 95, 158, 220}},
+		{"peak", 0, sine, []int{0, 63, 126, 189}},
+		{"peak wrapped", 2 * math.Pi, sine, []int{0, 63, 126, 189}},
+		{"negative", -math.Pi, sine, []int{32, 95, 158, 220}},
+		{"osc phase", math.Pi, OscParams{Type: "sine", Freq: 0.1, Amp: 1.0 / 30, Offset: 0.99, Phase: math.Pi / 2}, []int{16, 79, 142, 205}},
+		{"square", math.Pi, OscParams{Type: "square", Freq: 0.1, Amp: 1.0 / 30, Offset: 0.99}, []int{32, 95, 158, 220}},
+		{"fast", math.Pi, OscParams{Type: "sine", Freq: 1, Amp: 1.0 / 30, Offset: 0.99}, nil},
+		{"pink", math.Pi, OscParams{Type: "pink", Amp: 1.0 / 30, Offset: 0.99}, []int{}},
+	}
+	for _, tt := range tests {
+		rp := &RippleParams{}
+		rp.Defaults()
+		rp.On = true
+		rp.Phase = tt.phase
+		var got []int
+		for cyc := 0; cyc <= 250; cyc++ {
+			if rp.Due(cyc, "Sleep", &tt.op) {
+				got = append(got, cyc)
+			}
+		}
+		if tt.want == nil { // one per period, each at or just past the phase
+			per := 2 * math.Pi / tt.op.Freq
+			if n := len(got); math.Abs(float64(n)-251/per) > 1 {
+				t.Errorf("%s: %d ripples, want about %g", tt.name, n, 251/per)
+			}
+			for _, cyc := range got {
+				d := math.Mod(tt.op.Freq*float64(cyc)-tt.phase+4*math.Pi, 2*math.Pi)
+				if d >= tt.op.Freq {
+					t.Errorf("%s: ripple at %d is %g past the phase", tt.name, cyc, d)
+				}
+			}
+			continue
+		}
+		if !sameInts(got, tt.want) {
+			t.Errorf("%s: ripples at %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRippleDueStages(t *testing.T) {
+	op := OscParams{Type: "sine", Freq: 0.1, Amp: 1.0 / 30, Offset: 0.99}
+	rp := &RippleParams{}
+	rp.Defaults()
+	if rp.Due(32, "SWS", &op) {
+		t.Errorf("Due with the ripples off")
+	}
+	rp.On = true
+	rp.Stages = []string{"SWS"}
+	if !rp.Due(32, "SWS", &op) {
+		t.Errorf("not Due in a listed stage")
+	}
+	if rp.Due(32, "REM", &op) {
+		t.Errorf("Due in a stage that isn't listed")
+	}
+}
+
+func TestRippleValidate(t *testing.T) {
+	pink := OscParams{Type: "pink", Amp: 0.01, Offset: 0.99}
+	tests := []struct {
+		name string
+		set  func(sp *SleepParams)
+		nerr int
+	}{
+		{"defaults", func(sp *SleepParams) {}, 0},
+		{"on", func(sp *SleepParams) { sp.Ripple.On = true }, 0},
+		{"bad fields", func(sp *SleepParams) {
+			sp.Ripple.Mode = "x"
+			sp.Ripple.Dur = 0
+			sp.Ripple.Gain = -1
+			sp.Ripple.GiFactor = -1
+			sp.Ripple.Phase = math.NaN()
+		}, 5},
+		{"group", func(sp *SleepParams) { sp.Ripple.Group = "Mid" }, 1},
+		{"stage", func(sp *SleepParams) { sp.Ripple.Stages = []string{"SWS"} }, 1},
+		{"pink", func(sp *SleepParams) { sp.Ripple.On = true; sp.OscGroups[1].Osc = pink }, 1},
+		{"pink off", func(sp *SleepParams) { sp.OscGroups[1].Osc = pink }, 0},
+		{"pink stage", func(sp *SleepParams) {
+			sp.Ripple.On = true
+			sp.Stages = SleepStages{{Name: "SWS", Cycles: 100}, {Name: "REM", Cycles: 100, Osc: map[string]OscParams{"High": pink}}}
+		}, 1},
+		{"pink stage without ripples", func(sp *SleepParams) {
+			sp.Ripple.On = true
+			sp.Ripple.Stages = []string{"SWS"}
+			sp.Stages = SleepStages{{Name: "SWS", Cycles: 100}, {Name: "REM", Cycles: 100, Osc: map[string]OscParams{"High": pink}}}
+		}, 0},
+	}
+	for _, tt := range tests {
+		sp := &SleepParams{}
+		sp.Defaults()
+		tt.set(sp)
+		if errs := sp.Ripple.Validate(sp); len(errs) != tt.nerr {
+			t.Errorf("%s: Validate = %q, want %d errors", tt.name, errs, tt.nerr)
+		}
+	}
+}
+
+// sameInts returns true if the two slices have the same values, in order
+func sameInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
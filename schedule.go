@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// SchedModes are the modes of SchedParams
+var SchedModes = []string{"crit", "epochs", "trials", "precrit"}
+
+// SchedParams are the settings of when to sleep.  By default (crit), the model
+// sleeps once training reaches criterion, and the run then ends.  The other modes
+// sleep during training, which goes on after waking up until criterion (or
+// MaxEpcs), when the run ends without sleeping again.
+type SchedParams struct {
+	Mode        string  `def:"crit" desc:"when to sleep: crit = once training reaches criterion, and then end the run; epochs = every Epcs epochs of training; trials = a nap every Trials training trials; precrit = once the test pct correct reaches PreShPctCor and PreUnPctCor, before criterion"`
+	Epcs        int     `def:"1" min:"1" desc:"for epochs, number of training epochs between sleeps"`
+	Trials      int     `def:"105" min:"1" desc:"for trials, number of training trials between naps -- they need not line up with the end of the epoch"`
+	PreShPctCor float64 `def:"0.5" min:"0" max:"1" desc:"for precrit, test pct correct on shared features needed to sleep -- checked at each test, so it should be below Task.CritShPctCor"`
+	PreUnPctCor float64 `def:"0.5" min:"0" max:"1" desc:"for precrit, test pct correct on unique features needed to sleep"`
+	MaxSleeps   int     `min:"0" desc:"maximum number of sleeps in a run, other than with crit -- 0 = no limit (e.g., for precrit, to sleep after every test that reaches the thresholds)"`
+}
+
+// Defaults sets the default schedule params
+func (sc *SchedParams) Defaults() {
+	sc.Mode = "crit"
+	sc.Epcs = 1
+	sc.Trials = 105
+	sc.PreShPctCor = 0.5
+	sc.PreUnPctCor = 0.5
+	sc.MaxSleeps = 0
+}
+
+// Validate returns a description of each problem with the schedule params
+func (sc *SchedParams) Validate() []string {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	frac := func(nm string, v float64) {
+		if math.IsNaN(v) || v < 0 || v > 1 {
+			bad("%s must be between 0 and 1, is: %g", nm, v)
+		}
+	}
+	switch sc.Mode {
+	case "crit":
+	case "epochs":
+		if sc.Epcs <= 0 {
+			bad("Sched.Epcs must be > 0, is: %d", sc.Epcs)
+		}
+	case "trials":
+		if sc.Trials <= 0 {
+			bad("Sched.Trials must be > 0, is: %d", sc.Trials)
+		}
+	case "precrit":
+		frac("Sched.PreShPctCor", sc.PreShPctCor)
+		frac("Sched.PreUnPctCor", sc.PreUnPctCor)
+	default:
+		bad("Sched.Mode %q is not one of: %s", sc.Mode, strings.Join(SchedModes, ", "))
+	}
+	if sc.MaxSleeps < 0 {
+		bad("Sched.MaxSleeps must be >= 0, is: %d", sc.MaxSleeps)
+	}
+	return errs
+}
+
+// SleepDue returns true if the schedule calls for a sleep before the next
+// training trial.  chg is true at the start of a new epoch, epc, which has
+// just been tested if it is a multiple of TestInterval.
+func (ss *Sim) SleepDue(chg bool, epc int) bool {
+	sc := &ss.Sched
+	if !ss.ExecSleep || sc.Mode == "crit" || (sc.MaxSleeps > 0 && ss.SchedSleeps >= sc.MaxSleeps) {
+		return false
+	}
+	switch sc.Mode {
+	case "epochs":
+		return chg && epc%sc.Epcs == 0
+	case "trials":
+		return ss.SchedTrls >= sc.Trials
+	case "precrit":
+		tested := chg && ss.TestInterval > 0 && epc%ss.TestInterval == 0
+		return tested && ss.EpcShPctCor >= sc.PreShPctCor && ss.EpcUnPctCor >= sc.PreUnPctCor
+	}
+	return false
+}
+
+// SchedSleep does a sleep that was scheduled during training (see SleepDue): all
+// of its bouts, each followed by a test.  Returns false if it was stopped partway
+// -- TrainTrial calls it again to finish, and then goes on with training.
+func (ss *Sim) SchedSleep() bool {
+	if !ss.SleepBouts() {
+		return false
+	}
+	ss.SchedSlp = false
+	ss.SchedSleeps++
+	ss.SchedTrls = 0
+	return true
+}
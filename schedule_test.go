@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestSleepDue trains through 8 epochs of 10 trials on each schedule, sleeping
+// whenever SleepDue says to, and checks when the sleeps happen
+func TestSleepDue(t *testing.T) {
+	pctCor := []float64{0, 0.2, 0.4, 0.7, 0.6, 0.7, 0.8, 0.9} // test pct correct of each epoch
+	sleeps := func(sc SchedParams, exec bool) []string {
+		ss := &Sim{Sched: sc, ExecSleep: exec, TestInterval: 2}
+		var slps []string
+		for epc := 1; epc < 8; epc++ {
+			for trl := 0; trl < 10; trl++ {
+				chg := trl == 0
+				if chg && epc%ss.TestInterval == 0 {
+					ss.EpcShPctCor, ss.EpcUnPctCor = pctCor[epc], pctCor[epc]
+				}
+				if ss.SleepDue(chg, epc) {
+					slps = append(slps, fmt.Sprintf("%d.%d", epc, trl))
+					ss.SchedSleeps++
+					ss.SchedTrls = 0
+				}
+				ss.SchedTrls++
+			}
+		}
+		return slps
+	}
+
+	sc := SchedParams{}
+	sc.Defaults()
+	if slps := sleeps(sc, true); len(slps) != 0 {
+		t.Errorf("crit: slept during training at %v", slps)
+	}
+	sc.Mode = "epochs"
+	sc.Epcs = 3
+	if slps := sleeps(sc, false); len(slps) != 0 {
+		t.Errorf("without ExecSleep: slept at %v", slps)
+	}
+	if slps, want := sleeps(sc, true), []string{"3.0", "6.0"}; !reflect.DeepEqual(slps, want) {
+		t.Errorf("every 3 epochs: slept at %v, want %v", slps, want)
+	}
+	sc.MaxSleeps = 1
+	if slps, want := sleeps(sc, true), []string{"3.0"}; !reflect.DeepEqual(slps, want) {
+		t.Errorf("MaxSleeps 1: slept at %v, want %v", slps, want)
+	}
+
+	sc.Defaults()
+	sc.Mode = "trials"
+	sc.Trials = 25 // naps that don't line up with the epochs
+	if slps, want := sleeps(sc, true), []string{"3.5", "6.0"}; !reflect.DeepEqual(slps, want) {
+		t.Errorf("every 25 trials: slept at %v, want %v", slps, want)
+	}
+
+	// only right after a test that reaches the thresholds -- not at 3, which isn't tested
+	sc.Mode = "precrit"
+	sc.PreShPctCor, sc.PreUnPctCor = 0.6, 0.6
+	if slps, want := sleeps(sc, true), []string{"4.0", "6.0"}; !reflect.DeepEqual(slps, want) {
+		t.Errorf("precrit: slept at %v, want %v", slps, want)
+	}
+}
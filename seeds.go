@@ -0,0 +1,127 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// SeedStreams are the names of all the independent random streams used in a run.
+// Each one gets its own sub-seed derived from the master RndSeed and the run number,
+// so that every run can be replayed exactly from the master seed alone.
+// Env and Wts seed the global math/rand before the initial env order permutation and
+// InitWts, EnvOrder reseeds it before the TrainEnv step at the end of each epoch
+// (for the order permutation), Train is used for hidden feature selection in TrainTrial, SlpInit
+// for the random activations in SleepCycInit, SlpNoise for the noise kicks in SleepCyc,
+// SlpOsc for pink noise oscillations (see SlpOscillators), SlpCalib for the separate
+// activation and noise streams of the calibration segment of sleep (see CalibSlpThr), and the *ToHip / DGToCA3 seeds for the prjn.UnifRnd patterns into DG and CA3.
+var SeedStreams = []string{"Env", "Wts", "EnvOrder", "Train", "SlpInit", "SlpNoise", "SlpOsc", "SlpCalib", "DGToCA3", "F1ToHip", "F2ToHip", "F3ToHip", "F4ToHip", "F5ToHip", "ClassNameToHip", "CodeNameToHip"}
+
+// DeriveSeed returns the sub-seed for the named stream in the given run, derived
+// deterministically from the master seed.  The name is hashed (FNV-1a) and mixed with
+// the master seed and run through a SplitMix64 finalizer, so streams are independent
+// of each other and of the order in which they are requested.
+func DeriveSeed(master int64, run int, name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	z := uint64(master) ^ h.Sum64()
+	z += uint64(run+1) * 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z = z ^ (z >> 31)
+	return int64(z >> 1) // keep positive -- UnifRnd treats 0 as "pick one for me"
+}
+
+// RunSeed returns the sub-seed for the named stream in the current run
+func (ss *Sim) RunSeed(name string) int64 {
+	return DeriveSeed(ss.RndSeed, ss.TrainEnv.Run.Cur, name)
+}
+
+// InitRunSeeds derives all the sub-seeds for the current run from the master seed,
+// and (re)creates the private random streams used by training and sleep.
+func (ss *Sim) InitRunSeeds() {
+	if ss.RunSeeds == nil {
+		ss.RunSeeds = make(map[string]int64, len(SeedStreams))
+	}
+	for _, nm := range SeedStreams {
+		ss.RunSeeds[nm] = ss.RunSeed(nm)
+	}
+	ss.RndSrcs = make(map[string]*CountedSource, len(RndStreams))
+	for _, nm := range RndStreams {
+		ss.RndSrcs[nm] = NewCountedSource(ss.RunSeeds[nm])
+	}
+	ss.EnvOrderRnd = rand.New(ss.RndSrcs["EnvOrder"])
+	ss.TrainRnd = rand.New(ss.RndSrcs["Train"])
+	ss.SlpInitRnd = rand.New(ss.RndSrcs["SlpInit"])
+	ss.SlpNoiseRnd = rand.New(ss.RndSrcs["SlpNoise"])
+}
+
+// RndStreams are the SeedStreams that have their own private random stream on the
+// Sim (see InitRunSeeds) -- the rest are only used to seed the global rand or prjns.
+var RndStreams = []string{"EnvOrder", "Train", "SlpInit", "SlpNoise"}
+
+// CountedSource is a rand.Source that counts the number of values drawn from it,
+// so that its state can be saved as just its seed and count (e.g., in a checkpoint),
+// and restored by drawing that many values again from the same seed (see Skip).
+type CountedSource struct {
+	Seed0 int64 `desc:"seed the source was last seeded with"`
+	Draws int64 `desc:"number of values drawn since it was seeded"`
+	src   rand.Source64
+}
+
+// NewCountedSource returns a new CountedSource seeded with the given seed
+func NewCountedSource(seed int64) *CountedSource {
+	return &CountedSource{Seed0: seed, src: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (cs *CountedSource) Int63() int64 {
+	cs.Draws++
+	return cs.src.Int63()
+}
+
+func (cs *CountedSource) Uint64() uint64 {
+	cs.Draws++
+	return cs.src.Uint64()
+}
+
+func (cs *CountedSource) Seed(seed int64) {
+	cs.Seed0 = seed
+	cs.Draws = 0
+	cs.src.Seed(seed)
+}
+
+// Skip reseeds the source from its seed and draws from it until Draws = n,
+// restoring the state it had after n draws
+func (cs *CountedSource) Skip(n int64) {
+	cs.Seed(cs.Seed0)
+	for cs.Draws < n {
+		cs.Int63()
+	}
+}
+
+// GlobalRandMu guards the global math/rand source, which emergent and leabra use for
+// the env order permutations, the prjn.UnifRnd patterns and InitWts.  Everything that
+// seeds or draws from it must hold the lock (see WithGlobalRand), and reseed it first
+// if the draws matter, so that Sims running at the same time (see RunBatch) don't
+// interleave their draws and every run can still be replayed from its seeds.
+var GlobalRandMu sync.Mutex
+
+// WithGlobalRand calls fun while holding GlobalRandMu
+func WithGlobalRand(fun func()) {
+	GlobalRandMu.Lock()
+	defer GlobalRandMu.Unlock()
+	fun()
+}
+
+// SetCellInt64 sets an INT64 column value directly, so that seeds survive
+// logging without the precision loss of going through float64.
+func SetCellInt64(dt *etable.Table, colNm string, row int, val int64) {
+	col, ok := dt.ColByName(colNm).(*etensor.Int64)
+	if !ok {
+		return
+	}
+	col.Values[row] = val
+}
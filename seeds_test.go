@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestDeriveSeed(t *testing.T) {
+	seen := make(map[int64]string)
+	for _, master := range []int64{0, 1, 42, -7} {
+		for run := 0; run < 3; run++ {
+			for _, nm := range SeedStreams {
+				sd := DeriveSeed(master, run, nm)
+				if sd <= 0 {
+					t.Errorf("DeriveSeed(%d, %d, %q) = %d, want > 0", master, run, nm, sd)
+				}
+				if sd != DeriveSeed(master, run, nm) {
+					t.Errorf("DeriveSeed(%d, %d, %q) is not deterministic", master, run, nm)
+				}
+				key := fmt.Sprintf("%d/%d/%s", master, run, nm)
+				if prv, has := seen[sd]; has {
+					t.Errorf("DeriveSeed gives %d for both %s and %s", sd, prv, key)
+				}
+				seen[sd] = key
+			}
+		}
+	}
+}
+
+func TestDeriveSeedGolden(t *testing.T) {
+	// the seeds of the runs in existing run logs must not change
+	tests := []struct {
+		master int64
+		run    int
+		name   string
+		want   int64
+	}{
+		{1, 0, "Env", 1828530003279567972},
+		{1, 1, "Env", 3487454706852337997},
+		{42, 0, "SlpNoise", 7137758743377999406},
+		{-7, 3, "DGToCA3", 7547093714652504986},
+	}
+	for _, tt := range tests {
+		if got := DeriveSeed(tt.master, tt.run, tt.name); got != tt.want {
+			t.Errorf("DeriveSeed(%d, %d, %q) = %d, want %d", tt.master, tt.run, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCountedSourceSkip(t *testing.T) {
+	for _, n := range []int64{0, 1, 17, 1000} {
+		cs := NewCountedSource(12345)
+		rnd := rand.New(cs)
+		for cs.Draws < n {
+			rnd.Int63()
+		}
+		want := make([]int64, 10)
+		for i := range want {
+			want[i] = rnd.Int63()
+		}
+
+		rs := NewCountedSource(12345)
+		rs.Skip(n)
+		if rs.Draws != n {
+			t.Errorf("Skip(%d): Draws = %d", n, rs.Draws)
+		}
+		rrnd := rand.New(rs)
+		for i, w := range want {
+			if got := rrnd.Int63(); got != w {
+				t.Errorf("Skip(%d): draw %d = %d, want %d", n, i, got, w)
+			}
+		}
+	}
+}
+
+func TestCountedSourceMatchesSource(t *testing.T) {
+	cs := NewCountedSource(99)
+	ref := rand.NewSource(99).(rand.Source64)
+	for i := 0; i < 100; i++ {
+		if got, want := cs.Uint64(), ref.Uint64(); got != want {
+			t.Fatalf("draw %d = %d, want %d", i, got, want)
+		}
+	}
+	if cs.Draws != 100 {
+		t.Errorf("Draws = %d, want 100", cs.Draws)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/emer/etable/etable"
+	"github.com/goki/gi/gi"
+)
+
+// ExitInterrupted is the exit status of a command that was stopped by SIGINT or
+// SIGTERM, after saving what it had done (see HandleSignals)
+const ExitInterrupted = 3
+
+// InterruptMu guards the Interrupted flags and BatchSims of all sims.  Interrupt
+// doesn't set StopNow, which the run loops read without a lock -- they check both
+// through Stopping.
+var InterruptMu sync.Mutex
+
+// HandleSignals makes SIGINT (Ctrl-C) and SIGTERM stop the sim gracefully, for
+// running from the command line: the current trial or sleep cycle finishes, and
+// the command then returns with Interrupted set, for CmdArgs to save everything
+// (see SaveInterrupted).  A second signal exits right away.
+func (ss *Sim) HandleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		fmt.Fprintf(os.Stderr, "\nGot %v -- stopping after the current trial or sleep cycle and saving (again to quit now)\n", sig)
+		ss.Interrupt()
+		<-sigs
+		os.Exit(ExitInterrupted)
+	}()
+}
+
+// Interrupt stops this sim for good, along with all the sims it is running in
+// a batch or sweep.  Unlike Stop, a test that is underway is finished first, so
+// that the sim stops at a point that a checkpoint can resume from.
+func (ss *Sim) Interrupt() {
+	InterruptMu.Lock()
+	defer InterruptMu.Unlock()
+	ss.Interrupted = true
+	for bs := range ss.BatchSims {
+		bs.Interrupted = true
+	}
+}
+
+// IsInterrupted returns true if Interrupt has been called on this sim, or on the
+// sim that is running it in a batch or sweep -- the flag is set from the signal
+// goroutine, so it must always be read through here
+func (ss *Sim) IsInterrupted() bool {
+	InterruptMu.Lock()
+	defer InterruptMu.Unlock()
+	return ss.Interrupted
+}
+
+// Stopping returns true if the running sim is to stop after the current trial or
+// sleep cycle: StopNow is set, or it has been interrupted
+func (ss *Sim) Stopping() bool {
+	return ss.StopNow || ss.IsInterrupted()
+}
+
+// AddBatchSim adds a sim that this one is running in a batch or sweep, so that
+// Interrupt stops it too.  Returns false, without adding it, if this sim has
+// already been interrupted.
+func (ss *Sim) AddBatchSim(bs *Sim) bool {
+	InterruptMu.Lock()
+	defer InterruptMu.Unlock()
+	if ss.Interrupted {
+		return false
+	}
+	if ss.BatchSims == nil {
+		ss.BatchSims = make(map[*Sim]bool)
+	}
+	ss.BatchSims[bs] = true
+	return true
+}
+
+// DeleteBatchSim removes a sim added with AddBatchSim, once it is done
+func (ss *Sim) DeleteBatchSim(bs *Sim) {
+	InterruptMu.Lock()
+	defer InterruptMu.Unlock()
+	delete(ss.BatchSims, bs)
+}
+
+// FlushLogs makes sure that every log is on disk: the open log files are synced,
+// and the logs that aren't streamed to file are saved in full to the file they
+// would have been streamed to
+func (ss *Sim) FlushLogs() {
+	slots := ss.LogFileSlots()
+	for lnm, dt := range ss.LogTables() {
+		if fp := *slots[lnm]; fp != nil {
+			fp.Sync()
+			continue
+		}
+		if dt.Rows == 0 {
+			continue
+		}
+		fnm := ss.LogFileName(lnm)
+		fmt.Printf("Saving %s log to: %v\n", lnm, fnm)
+		if err := dt.SaveCSV(gi.FileName(fnm), etable.Tab, etable.Headers); err != nil {
+			fmt.Fprintf(os.Stderr, "could not save %s log: %v\n", lnm, err)
+		}
+	}
+}
+
+// SaveInterrupted saves everything an interrupted sim has in memory: every log
+// is flushed (see FlushLogs), and then either a checkpoint that training can be
+// resumed from (if ckpt) or the current weights are saved
+func (ss *Sim) SaveInterrupted(ckpt bool) {
+	ss.FlushLogs()
+	if ckpt {
+		ss.AutoCheckpoint()
+		return
+	}
+	fnm := ss.WeightsFileName()
+	fmt.Printf("Saving Weights to: %v\n", fnm)
+	ss.SaveWeights(gi.FileName(fnm))
+}
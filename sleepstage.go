@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/schapirolab/leabra-sleep/hip"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// SleepStage is one stage of sleep, such as NREM2, SWS or REM, with its own
+// length and settings.  Settings that aren't set in the stage are the same as
+// for the rest of sleep (Slp, SynDep, SlpLearn).
+type SleepStage struct {
+	Name      string               `desc:"name of the stage -- logged in the Stage column of the SlpCycLog"`
+	Cycles    int                  `min:"1" desc:"number of cycles in the stage"`
+	Osc       map[string]OscParams `desc:"oscillation of each group during the stage, by group name (see Slp.OscGroups) -- groups that aren't listed keep their own"`
+	SynDep    *bool                `desc:"whether there is synaptic depression during the stage -- turning it back on starts the depression over"`
+	CA3RecAbs *float32             `desc:"WtScale.Abs of CA3 -> CA3 during the stage"`
+	CA1PerAbs *float32             `desc:"WtScale.Abs of CA1 -> perceptual layers during the stage"`
+	Learn     *bool                `desc:"whether to learn during the stage -- each stage starts outside of any plus or minus phase"`
+}
+
+// SleepStages are the stages of a sleep trial, which repeat in order, as
+// ultradian cycles, until the end of the trial
+type SleepStages []SleepStage
+
+// UnmarshalJSON replaces the stages with those in the JSON, rather than decoding
+// each one on top of the stage that was at the same position (see OscGroups)
+func (sts *SleepStages) UnmarshalJSON(b []byte) error {
+	var stages []SleepStage
+	if err := DecodeStrict(b, &stages); err != nil {
+		return err
+	}
+	*sts = stages
+	return nil
+}
+
+// AllStages returns the stages of a sleep trial -- a single stage named Sleep,
+// with nothing of its own, that lasts the whole trial if there are no Stages
+func (sp *SleepParams) AllStages() SleepStages {
+	if len(sp.Stages) == 0 {
+		return SleepStages{{Name: "Sleep", Cycles: sp.Cycles}}
+	}
+	return sp.Stages
+}
+
+// StageAt returns the index of the stage that the given cycle of a sleep trial
+// is in, the ultradian cycle (repetition of the stages) it is in, and whether
+// the stage starts at that cycle
+func (sp *SleepParams) StageAt(cyc int) (st, ult int, start bool) {
+	sts := sp.AllStages()
+	period := 0
+	for i := range sts {
+		period += sts[i].Cycles
+	}
+	ult = cyc / period
+	pos := cyc % period
+	for st = range sts {
+		if pos < sts[st].Cycles {
+			break
+		}
+		pos -= sts[st].Cycles
+	}
+	return st, ult, pos == 0
+}
+
+// ValidateStages returns a description of each problem with the stages
+func (sp *SleepParams) ValidateStages() []string {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	for i := range sp.Stages {
+		st := &sp.Stages[i]
+		nm := fmt.Sprintf("Slp.Stages[%d]", i)
+		if st.Name == "" {
+			bad("%s.Name must be set", nm)
+		}
+		if st.Cycles <= 0 {
+			bad("%s.Cycles must be > 0, is: %d", nm, st.Cycles)
+		}
+		gnms := make([]string, 0, len(st.Osc))
+		for gnm := range st.Osc {
+			gnms = append(gnms, gnm)
+		}
+		sort.Strings(gnms)
+		for _, gnm := range gnms {
+			op := st.Osc[gnm]
+			og := sp.OscGroups.Group(gnm)
+			if og == nil {
+				bad("%s.Osc: %q is not one of the Slp.OscGroups", nm, gnm)
+				continue
+			}
+			sog := *og
+			sog.Osc = op
+			errs = append(errs, sog.ValidateOsc(fmt.Sprintf("%s.Osc[%q]", nm, gnm))...)
+		}
+		if st.CA3RecAbs != nil && *st.CA3RecAbs < 0 {
+			bad("%s.CA3RecAbs must be >= 0, is: %g", nm, *st.CA3RecAbs)
+		}
+		if st.CA1PerAbs != nil && *st.CA1PerAbs < 0 {
+			bad("%s.CA1PerAbs must be >= 0, is: %g", nm, *st.CA1PerAbs)
+		}
+	}
+	return errs
+}
+
+// StageOscGroups returns the oscillation groups as they are during the given stage
+func (ss *Sim) StageOscGroups(st *SleepStage) OscGroups {
+	if len(st.Osc) == 0 {
+		return ss.Slp.OscGroups
+	}
+	ogs := make(OscGroups, len(ss.Slp.OscGroups))
+	copy(ogs, ss.Slp.OscGroups)
+	for i := range ogs {
+		if op, has := st.Osc[ogs[i].Name]; has {
+			ogs[i].Osc = op
+		}
+	}
+	return ogs
+}
+
+// StageSynDep returns whether there is synaptic depression during the given stage
+func (ss *Sim) StageSynDep(st *SleepStage) bool {
+	if st.SynDep != nil {
+		return *st.SynDep
+	}
+	return ss.SynDep
+}
+
+// StageLearn returns whether there is learning during the given stage
+func (ss *Sim) StageLearn(st *SleepStage) bool {
+	if st.Learn != nil {
+		return *st.Learn
+	}
+	return ss.SlpLearn
+}
+
+// StageOscs are the oscillators of a sleep stage (see SlpOscillators)
+type StageOscs struct {
+	Oscs   []Oscillator
+	LyOscs []LayerOsc
+}
+
+// SlpStageOscs returns the oscillators of each stage of a sleep trial
+func (ss *Sim) SlpStageOscs() ([]StageOscs, error) {
+	sts := ss.Slp.AllStages()
+	sos := make([]StageOscs, len(sts))
+	for i := range sts {
+		oscs, lyoscs, err := ss.SlpOscillators(ss.StageOscGroups(&sts[i]))
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: %v", sts[i].Name, err)
+		}
+		sos[i] = StageOscs{oscs, lyoscs}
+	}
+	return sos, nil
+}
+
+// StartSlpStage sets the network up for the given stage of sleep: the CA3 -> CA3
+// and CA1 -> perceptual prjn scaling, and synaptic depression.  Any plus or minus
+// phase that is underway is dropped.
+func (ss *Sim) StartSlpStage(st *SleepStage) {
+	ss.SlpStage = st.Name
+
+	ca3abs := ss.Slp.StageCA3RecAbs(st)
+	ca1abs := ss.Slp.CA1PerAbs
+	if st.CA1PerAbs != nil {
+		ca1abs = *st.CA1PerAbs
+	}
+	ca3 := ss.Net.LayerByName("CA3").(leabra.LeabraLayer).AsLeabra()
+	ca3.RcvPrjns.SendName("CA3").(*hip.CHLPrjn).WtScale.Abs = ca3abs
+
+	perlys := []string{"F1", "F2", "F3", "F4", "F5", "ClassName", "CodeName"}
+	for _, ly := range perlys {
+		lyc := ss.Net.LayerByName(ly).(*leabra.Layer).AsLeabra()
+		lycfmca1 := lyc.RcvPrjns.SendName("CA1").(*hip.CHLPrjn)
+		lycfmca1.WtScale.Abs = ca1abs // Increasing wtscaling from CA1 to perception layers leads to better replays
+	}
+
+	ss.Net.GScaleFmAvgAct() // update computed scaling factors
+	ss.Net.InitGInc()       // scaling params change, so need to recompute all netins
+
+	// turning syn dep off leaves it initialized, with no depression, so that the synapses stay in sleep mode
+	if sd := ss.StageSynDep(st); sd != ss.SynDepOn {
+		ss.InitSynDep(sd)
+	}
+
+	if ss.PlusPhase || ss.MinusPhase || ss.StableCnt > 0 {
+		ss.PlusPhase = false
+		ss.MinusPhase = false
+		ss.PlusCnt = 0
+		ss.MinusCnt = 0
+		ss.StableCnt = 0
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestStageAt(t *testing.T) {
+	sp := &SleepParams{}
+	sp.Defaults()
+	sp.Cycles = 1000
+	for cyc := 0; cyc < sp.Cycles; cyc++ { // no stages: one stage for the whole trial
+		if st, ult, start := sp.StageAt(cyc); st != 0 || ult != 0 || start != (cyc == 0) {
+			t.Fatalf("no stages: StageAt(%d) = %d, %d, %v, want 0, 0, %v", cyc, st, ult, start, cyc == 0)
+		}
+	}
+
+	// the stages, laid out cycle by cycle over three ultradian cycles, with a
+	// one-cycle stage so that two stages start in a row
+	sp.Stages = SleepStages{{Name: "NREM2", Cycles: 100}, {Name: "SWS", Cycles: 300}, {Name: "Wake", Cycles: 1}, {Name: "REM", Cycles: 50}}
+	var wst, wult []int
+	var wstart []bool
+	for ult := 0; ult < 3; ult++ {
+		for si, st := range sp.Stages {
+			for c := 0; c < st.Cycles; c++ {
+				wst = append(wst, si)
+				wult = append(wult, ult)
+				wstart = append(wstart, c == 0)
+			}
+		}
+	}
+	for cyc := range wst {
+		if st, ult, start := sp.StageAt(cyc); st != wst[cyc] || ult != wult[cyc] || start != wstart[cyc] {
+			t.Fatalf("StageAt(%d) = %d, %d, %v, want %d, %d, %v", cyc, st, ult, start, wst[cyc], wult[cyc], wstart[cyc])
+		}
+	}
+}
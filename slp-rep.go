@@ -5,9 +5,9 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"github.com/goki/ki/bitflag"
+	"io"
 	"log"
 	"math"
 	"math/rand"
@@ -29,6 +29,7 @@ import (
 	"github.com/emer/etable/etable"
 	"github.com/emer/etable/etensor"
 	_ "github.com/emer/etable/etview" // include to get gui views
+	"github.com/emer/etable/minmax"
 	"github.com/emer/etable/split"
 	"github.com/goki/gi/gi"
 	"github.com/goki/gi/gimain"
@@ -41,7 +42,7 @@ func main() {
 	TheSim.New()
 	TheSim.Config()
 	if len(os.Args) > 1 {
-		TheSim.CmdArgs() // simple assumption is that any args = no gui -- could add explicit arg if you want
+		TheSim.CmdArgs() // any args = no gui -- first arg can be a subcommand, see cmd.go
 	} else {
 		gimain.Main(func() { // this starts gui -- requires valid OpenGL display connection (e.g., X11)
 			guirun()
@@ -88,28 +89,77 @@ type Sim struct {
 	ViewOn       bool              `desc:"whether to update the network view while running"`
 	TrainUpdt    leabra.TimeScales `desc:"at what time scale to update the display during training?  Anything longer than Epoch updates at Epoch in this model"`
 	TestUpdt     leabra.TimeScales `desc:"at what time scale to update the display during testing?  Anything longer than Epoch updates at Epoch in this model"`
-	TestInterval int               `desc:"how often to run through all the test patterns, in terms of training epochs -- can use 0 or -1 for no testing"`
+	TestInterval int               `desc:"how often to run through all the test patterns, in terms of training epochs -- can use 0 or -1 for no testing, in which case the test stats of the run log are NaN"`
+	Task         TaskParams        `view:"inline" desc:"task and criterion settings"`
 
 	// Sleep implementation vars
 	SleepEnv    env.FixedTable    `desc:"Training environment -- contains everything about iterating over sleep trials"`
 	SlpCycLog   *etable.Table     `view:"no-inline" desc:"sleeping cycle-level log data"`
+	ReplayLog   *etable.Table     `view:"no-inline" desc:"replay events during sleep, decoded into training items (see Slp.Replay)"`
+	SlpWtLog    *etable.Table     `view:"no-inline" desc:"mean and variance of the weights of each prjn before and after each sleep trial (see Slp.Homeo)"`
+	SlpPhaseLog *etable.Table     `view:"no-inline" desc:"plus / minus phase pairs of sleep, the unit of sleep learning"`
+	PrjnWtLog   *etable.Table     `view:"no-inline" desc:"weight changes, mean weight and weight variance of each prjn, after each training epoch and every Slp.WtLogCycs cycles of sleep"`
 	SlpCycPlot  *eplot.Plot2D     `view:"-" desc:"the sleeping cycle plot"`
-	MaxSlpCyc   int               `desc:"maximum number of cycle to sleep for a trial"`
 	Sleep       bool              `desc:"Sleep or not"`
 	LrnDrgSlp   bool              `desc:"Learning during sleep?"`
-	SlpPlusThr  float32           `desc:"The threshold for entering a sleep plus phase"`
-	SlpMinusThr float32           `desc:"The threshold for entering a sleep minus phase"`
+	Slp         SleepParams       `view:"inline" desc:"sleep length, oscillation, syn dep and stability threshold settings"`
+	Sched       SchedParams       `view:"inline" desc:"when to sleep -- at criterion, or during training"`
 	InhibOscil  bool              `desc:"whether to implement inhibition oscillation"`
 	SleepUpdt   leabra.TimeScales `desc:"at what time scale to update the display during sleep? Anything longer than Epoch updates at Epoch in this model"`
 	InhibFactor float64           `desc:"The inhib oscill factor for this cycle"`
-	AvgLaySim   float64           `desc:"Average layer similaity between this cycle and last cycle"`
+	OscVals     []float64         `inactive:"+" desc:"value of each group's inhibitory oscillation for this cycle, in the order of Slp.OscGroups"`
+	AvgLaySim   float64           `desc:"stability of the network at this cycle -- by default, the average layer similarity between this cycle and last cycle (see Slp.Stability)"`
+	LaySims     []float64         `view:"-" desc:"Sim of each layer at this cycle of sleep -- NaN where it is undefined"`
+	LayContribs []float64         `view:"-" desc:"contribution of each layer to AvgLaySim at this cycle of sleep"`
+	LayNaN      []bool            `view:"-" desc:"whether the Sim of each layer is NaN at this cycle of sleep (see LaySimNaNs)"`
+	StabHist    ActHist           `view:"-" desc:"activations of the last cycles of sleep, for the window stability metric"`
 	SynDep      bool              `desc:"Syn Dep during sleep?"`
 	SlpLearn    bool              `desc:"Learn during sleep?"`
 	PlusPhase   bool              `desc:"Sleep Plusphase on/off"`
 	MinusPhase  bool              `desc:"Sleep Minusphase on/off"`
 	ZError      int               `desc:"Consec Zero error epochs"`
 	ExecSleep	bool			  `desc:"Execute Sleep?"`
-	SlpTrls		int				  `desc:"Number of sleep trials"`
+	SlpTrls		int				  `desc:"Number of completed plus / minus phase pairs (learning events) in the current sleep trial"`
+	Sleeping    bool              `inactive:"+" desc:"true in the middle of a sleep trial -- one that was stopped partway picks up from SlpCyc when resumed"`
+	SlpCyc      int               `inactive:"+" desc:"cycle of the current sleep trial"`
+	SlpBout     int               `inactive:"+" desc:"number of bouts done in the current sleep (see Slp.Bouts) -- 0 outside of sleep"`
+	SchedSlp    bool              `inactive:"+" desc:"true in a sleep that was scheduled during training (see Sched), after which training goes on -- rather than at criterion"`
+	SchedSleeps int               `inactive:"+" desc:"number of scheduled sleeps so far in the current run"`
+	SchedTrls   int               `inactive:"+" desc:"number of training trials since the last scheduled sleep, or the start of the run"`
+	StableCnt   int               `view:"-" desc:"number of cycles in a row that AvgLaySim has been above Slp.PlusThr, outside of the plus and minus phases"`
+	PlusCnt     int               `view:"-" desc:"number of cycles in the current sleep plus phase"`
+	MinusCnt    int               `view:"-" desc:"number of cycles in the current sleep minus phase"`
+	SlpWakeGi   map[string]float32 `view:"-" desc:"Inhib.Layer.Gi of each layer from before sleep, which the inhibitory oscillations modulate, by layer name"`
+	SlpStage    string            `inactive:"+" desc:"name of the current stage of sleep (see Slp.Stages)"`
+	SlpUltCyc   int               `inactive:"+" desc:"ultradian cycle of the current sleep trial -- number of times the stages have all been through"`
+	SynDepOn    bool              `view:"-" desc:"whether synaptic depression is on in the current stage of sleep"`
+	SlpSynDeps  []*PrjnSynDep     `view:"-" desc:"syn dep params of each prjn during sleep, from Slp and the SynDep params sheets (see PrjnSynDeps)"`
+	PrjnDep     []float64         `view:"-" desc:"mean depression of the effective weights of each prjn of SlpSynDeps, for the current sleep cycle"`
+	SlpPlasts   []*PrjnPlasticity `view:"-" desc:"learning rule of each prjn during sleep, from Slp.Plasticity and the Plasticity params sheets (see PrjnPlasticities)"`
+	PlusActs    [][]float32       `view:"-" desc:"sum of the activation of each neuron over the current sleep plus phase, by layer, for the hebb and bcm sleep learning rules and the SlpPhaseLog"`
+	MinusActs   [][]float32       `view:"-" desc:"sum of the activation of each neuron over the current sleep minus phase, by layer, for the SlpPhaseLog"`
+	PhaseEvt    SlpPhaseEvt       `view:"-" desc:"plus / minus phase pair of sleep that is underway"`
+	BCMThr      map[string][]float32 `view:"-" desc:"sliding threshold of each neuron for the bcm sleep learning rule, by layer name -- only for the receiving layers of bcm prjns, and started over at each sleep trial"`
+	PreSlpWts   []WtStats         `view:"-" desc:"mean and variance of the weights of each prjn at the start of the current sleep trial, in the order of SynDepPrjns"`
+	SlpHomeoN   int               `inactive:"+" desc:"number of times the weights have been downscaled in the current sleep trial (see Slp.Homeo)"`
+	WtSnap      [][]float32       `view:"-" desc:"weights of each prjn at the last row of the PrjnWtLog, which its weight changes are from (see PrjnWts)"`
+	PlusThr     float64           `inactive:"+" desc:"AvgLaySim threshold for the sleep plus phases in the current run -- Slp.PlusThr, or calibrated (see Slp.Calib)"`
+	MinusThr    float64           `inactive:"+" desc:"AvgLaySim threshold below which a sleep minus phase ends in the current run -- Slp.MinusThr, or calibrated"`
+	SlpCalibrated bool            `inactive:"+" desc:"true once the stability thresholds have been calibrated in the current run"`
+	SlpCalib    bool              `view:"-" desc:"true while SleepCyc runs the calibration segment of sleep (see CalibSlpThr)"`
+	CalibSims   []float64         `view:"-" desc:"AvgLaySim of each cycle of the calibration segment, after Slp.Calib.Skip"`
+	SlpNoiseNrns int              `inactive:"+" desc:"number of neurons that noise was injected into at the current cycle of sleep (see Slp.Noise)"`
+	SlpNoiseN   int               `inactive:"+" desc:"number of cycles of the current sleep trial at which noise has been injected"`
+	RunNoiseN   int               `inactive:"+" desc:"number of cycles of sleep at which noise has been injected in the current run"`
+	ReplayDecItems []ReplayItem   `view:"-" desc:"training items that replay events are decoded into (see ReplayItems)"`
+	PlusEvt     ReplayEvent       `view:"-" desc:"replay event of the current sleep plus phase"`
+	StableEvt   ReplayEvent       `view:"-" desc:"replay event of the current stable period of sleep (see Slp.Replay.Stable)"`
+	RippleEvt   ReplayEvent       `view:"-" desc:"replay event of the current sharp-wave ripple of sleep (see Slp.Ripple)"`
+	RippleLeft  int               `inactive:"+" desc:"number of cycles left in the current sharp-wave ripple, including the current cycle -- 0 if there is none (see Slp.Ripple)"`
+	RippleN     int               `inactive:"+" desc:"number of sharp-wave ripples in the current sleep trial"`
+	CueItem     string            `inactive:"+" desc:"item that is being cued at the current cycle of sleep, if any (see Slp.Cue)"`
+	CuePats     map[string]map[string][]float32 `view:"-" desc:"cue of each cued item: its pattern in each cued layer, times Slp.Cue.Strength (see CuePatterns)"`
+	CueClampHard map[string]bool  `view:"-" desc:"Act.Clamp.Hard of each cued layer from before sleep, which is off during sleep so that the cues are soft-clamped"`
 
 	// statistics: note use float64 as that is best for etable.Table - DS Note: TrlSSE, TrlAvgSSE, TrlCosDiff don't need Shared and Unique vals... only accumulators do.
 	TestNm     string  `inactive:"+" desc:"what set of patterns are we currently testing"`
@@ -134,6 +184,22 @@ type Sim struct {
 	UnFirstZero  int     `inactive:"+" desc:"epoch at when Mem err first went to zero"`
 	UnNZero      int     `inactive:"+" desc:"number of epochs in a row with zero Mem err"`
 
+	// test stats from before sleep, for comparing with the final (post-sleep) ones
+	PreShSSE     float64 `inactive:"+" desc:"shared SSE of the last test before sleep in this run -- the same as the final EpcShSSE if the run did not sleep"`
+	PreShPctCor  float64 `inactive:"+" desc:"shared pct correct of the last test before sleep in this run -- the same as the final EpcShPctCor if the run did not sleep"`
+	PreUnSSE     float64 `inactive:"+" desc:"unique SSE of the last test before sleep in this run -- the same as the final EpcUnSSE if the run did not sleep"`
+	PreUnPctCor  float64 `inactive:"+" desc:"unique pct correct of the last test before sleep in this run -- the same as the final EpcUnPctCor if the run did not sleep"`
+
+	// test stats split into the items that are cued during sleep and the rest (see Slp.Cue) -- NaN for a group with no items
+	EpcCuSSE    float64 `inactive:"+" desc:"last epoch's sum squared error of the cued items"`
+	EpcCuPctCor float64 `inactive:"+" desc:"last epoch's percent of trials of the cued items that had SSE == 0"`
+	EpcUcSSE    float64 `inactive:"+" desc:"last epoch's sum squared error of the uncued items"`
+	EpcUcPctCor float64 `inactive:"+" desc:"last epoch's percent of trials of the uncued items that had SSE == 0"`
+	PreCuSSE    float64 `inactive:"+" desc:"cued SSE of the last test before sleep in this run"`
+	PreCuPctCor float64 `inactive:"+" desc:"cued pct correct of the last test before sleep in this run"`
+	PreUcSSE    float64 `inactive:"+" desc:"uncued SSE of the last test before sleep in this run"`
+	PreUcPctCor float64 `inactive:"+" desc:"uncued pct correct of the last test before sleep in this run"`
+
 	// internal state - view:"-"
 	// DS: Need separate Shared and Unique feature sums for tracking within epcs
 	ShTrlNum     int     `inactive:"+" desc:"last epoch's total number of Shared Trials"`
@@ -148,6 +214,13 @@ type Sim struct {
 	UnSumCosDiff float64 `view:"-" inactive:"+" desc:"sum to increment as we go through epoch"`
 	UnCntErr     int     `view:"-" inactive:"+" desc:"sum of errs to increment as we go through epoch"`
 
+	CuTrlNum int     `view:"-" inactive:"+" desc:"number of test trials of the cued items so far in the epoch"`
+	CuSumSSE float64 `view:"-" inactive:"+" desc:"sum to increment as we go through epoch"`
+	CuCntErr int     `view:"-" inactive:"+" desc:"sum of errs to increment as we go through epoch"`
+	UcTrlNum int     `view:"-" inactive:"+" desc:"number of test trials of the uncued items so far in the epoch"`
+	UcSumSSE float64 `view:"-" inactive:"+" desc:"sum to increment as we go through epoch"`
+	UcCntErr int     `view:"-" inactive:"+" desc:"sum of errs to increment as we go through epoch"`
+
 	HiddenType    string `view:"-" inactive:"+" desc:"Feature type that is Hidden on this trial - Shared or Unique"`
 	HiddenFeature string `view:"-" inactive:"+" desc:"Feature that is Hidden on this trial - F1-F5"`
 
@@ -160,7 +233,17 @@ type Sim struct {
 	TstTrlPlot *eplot.Plot2D    `view:"-" desc:"the test-trial plot"`
 	TstCycPlot *eplot.Plot2D    `view:"-" desc:"the test-cycle plot"`
 	RunPlot    *eplot.Plot2D    `view:"-" desc:"the run plot"`
+	PrjnWtPlot *eplot.Plot2D    `view:"-" desc:"the prjn weight plot"`
+	TrnTrlFile *os.File         `view:"-" desc:"log file"`
 	TrnEpcFile *os.File         `view:"-" desc:"log file"`
+	TstTrlFile *os.File         `view:"-" desc:"log file"`
+	TstEpcFile *os.File         `view:"-" desc:"log file"`
+	TstCycFile *os.File         `view:"-" desc:"log file"`
+	SlpCycFile *os.File         `view:"-" desc:"log file"`
+	ReplayFile *os.File         `view:"-" desc:"log file"`
+	SlpWtFile  *os.File         `view:"-" desc:"log file"`
+	SlpPhaseFile *os.File       `view:"-" desc:"log file"`
+	PrjnWtFile *os.File         `view:"-" desc:"log file"`
 	RunFile    *os.File         `view:"-" desc:"log file"`
 	TmpVals    []float32        `view:"-" desc:"temp slice for holding values -- prevent mem allocs"`
 	LayStatNms []string         `view:"-" desc:"names of layers to collect more detailed stats on (avg act, etc)"`
@@ -170,9 +253,22 @@ type Sim struct {
 	LogSetParams bool  `view:"-" desc:"if true, print message for all params that are set"`
 	IsRunning    bool  `view:"-" desc:"true if sim is running"`
 	StopNow      bool  `view:"-" desc:"flag to stop running"`
+	Interrupted  bool  `view:"-" desc:"set by Interrupt, e.g., on SIGINT -- stops running for good, after finishing any test that is underway -- read it with IsInterrupted"`
+	BatchSims    map[*Sim]bool `view:"-" desc:"sims that this one is running in a batch or sweep, which Interrupt also stops"`
 	NeedsNewRun  bool  `view:"-" desc:"flag to initialize NewRun if last one finished"`
-	RndSeed      int64 `view:"-" desc:"the current random seed"`
+	RndSeed      int64 `desc:"master random seed -- every random stream in a run is derived from this and the run number (see SeedStreams), so a run can be replayed exactly"`
 	DirSeed      int64 `view:"-" desc:"the current random seed for dir"`
+	RunSeeds     map[string]int64 `view:"-" desc:"sub-seeds derived from RndSeed for the current run, by stream name"`
+	TrainRnd     *rand.Rand       `view:"-" desc:"random stream for hidden feature selection in TrainTrial"`
+	SlpInitRnd   *rand.Rand       `view:"-" desc:"random stream for the sleep activation initialization in SleepCycInit"`
+	SlpNoiseRnd  *rand.Rand       `view:"-" desc:"random stream for the noise kicks in SleepCyc"`
+	EnvOrderRnd  *rand.Rand       `view:"-" desc:"random stream that the global rand is reseeded from before the last TrainEnv step of each epoch, for the order permutation it does"`
+	RndSrcs      map[string]*CountedSource `view:"-" desc:"sources of the private random streams, by stream name (see RndStreams) -- they count their draws so that a checkpoint can restore them"`
+	OutDir       string           `view:"-" desc:"directory that all the output files of this invocation are saved in (see NewOutDir) -- empty = the current directory"`
+	LogSfx       string           `view:"-" desc:"extra suffix for log file names, so that sims running at the same time don't write to the same files -- e.g., the run number in RunBatch"`
+	LogOffs      map[string]int64 `view:"-" desc:"offsets that each log file is resumed at, by log name, when resuming from a checkpoint (see OpenLogFile)"`
+	CkptEpcs     int              `view:"-" desc:"for command-line run only, save a checkpoint at the end of every this many training epochs -- 0 = never"`
+	CkptSlpCycs  int              `view:"-" desc:"for command-line run only, save a checkpoint every this many cycles of sleep during training -- 0 = never"`
 
 }
 
@@ -206,22 +302,28 @@ func (ss *Sim) New() {
 	ss.LayStatNms = []string{"F1", "F2", "F3", "F4", "F5", "ClassName", "CodeName", "CA1", "DG", "CA3"}
 	ss.TstNms = []string{"Sat"}
 	ss.TrialPerEpc = 105
+	ss.Task.Defaults()
 	ss.ShTrlNum = 0
 	ss.UnTrlNum = 0
 	ss.MaxRuns = 30
 	ss.ZError = 0
 
 	ss.SlpCycLog = &etable.Table{}
+	ss.ReplayLog = &etable.Table{}
+	ss.SlpWtLog = &etable.Table{}
+	ss.SlpPhaseLog = &etable.Table{}
+	ss.PrjnWtLog = &etable.Table{}
 	ss.Sleep = false
 	ss.InhibOscil = true
 	ss.SleepUpdt = leabra.Cycle
-	ss.MaxSlpCyc = 50000
 	ss.SynDep = true
 	ss.SlpLearn = true
 	ss.PlusPhase = false
 	ss.MinusPhase = false
 	ss.ExecSleep = true
 	ss.SlpTrls = 0
+	ss.Slp.Defaults()
+	ss.Sched.Defaults()
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////
@@ -241,6 +343,10 @@ func (ss *Sim) Config() {
 	ss.ConfigRunLog(ss.RunLog)
 
 	ss.ConfigSlpCycLog(ss.SlpCycLog)
+	ss.ConfigReplayLog(ss.ReplayLog)
+	ss.ConfigSlpWtLog(ss.SlpWtLog)
+	ss.ConfigSlpPhaseLog(ss.SlpPhaseLog)
+	ss.ConfigPrjnWtLog(ss.PrjnWtLog)
 }
 
 func (ss *Sim) ConfigEnv() {
@@ -271,9 +377,11 @@ func (ss *Sim) ConfigEnv() {
 	ss.SleepEnv.Table = etable.NewIdxView(ss.TrainSat) // this is needed for the configenv to happen correctly even if no pats are ever shown
 	ss.SleepEnv.Validate()
 
-	ss.TrainEnv.Init(0)
-	ss.TestEnv.Init(0)
-	ss.SleepEnv.Init(0)
+	WithGlobalRand(func() { // env Init permutes the order from the global rand
+		ss.TrainEnv.Init(0)
+		ss.TestEnv.Init(0)
+		ss.SleepEnv.Init(0)
+	})
 }
 
 func (ss *Sim) ConfigNet(net *leabra.Network) {
@@ -325,14 +433,14 @@ func (ss *Sim) ConfigNet(net *leabra.Network) {
 
 	spconn2 := prjn.NewUnifRnd()
 	spconn2.PCon = 0.05
-	spconn2.RndSeed = ss.RndSeed
+	spconn2.RndSeed = ss.RunSeed("DGToCA3")
 
 	// Per-Hip
 	for _, lyc := range PerLays {
 
 		spconn := prjn.NewUnifRnd()
 		spconn.PCon = 0.09 // 0.09 is the limit for how sparse you can get here.
-		spconn.RndSeed = ss.RndSeed
+		spconn.RndSeed = ss.RunSeed(lyc + "ToHip")
 
 		ly := ss.Net.LayerByName(lyc).(leabra.LeabraLayer).AsLeabra()
 
@@ -346,9 +454,6 @@ func (ss *Sim) ConfigNet(net *leabra.Network) {
 		pj.SetClass("PerCA1Prjn")
 		pj = net.ConnectLayersPrjn(ca1, ly, conn, emer.Back, &hip.CHLPrjn{})
 		pj.SetClass("PerCA1Prjn")
-
-		time.Sleep(1)
-		ss.NewRndSeed()
 	}
 
 	pj := net.ConnectLayersPrjn(ca3, ca3, conn, emer.Lateral, &hip.CHLPrjn{})
@@ -375,12 +480,17 @@ func (ss *Sim) ConfigNet(net *leabra.Network) {
 
 	net.Defaults()
 	ss.SetParams("Network", ss.LogSetParams) // only set Network params
-	err := net.Build()
+	var err error
+	WithGlobalRand(func() { // UnifRnd prjns and InitWts use the global rand
+		err = net.Build()
+		if err == nil {
+			net.InitWts()
+		}
+	})
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	net.InitWts()
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -389,7 +499,6 @@ func (ss *Sim) ConfigNet(net *leabra.Network) {
 // Init restarts the run, and initializes everything, including network weights
 // and resets the epoch log table
 func (ss *Sim) Init() {
-	rand.Seed(ss.RndSeed)
 	ss.ConfigEnv() // re-config env just in case a different set of patterns was
 	// selected or patterns have been modified etc
 	ss.StopNow = false
@@ -398,8 +507,8 @@ func (ss *Sim) Init() {
 	ss.UpdateView("train")
 }
 
-// NewRndSeed gets a new random seed based on current time -- otherwise uses
-// the same random seed for every run
+// NewRndSeed gets a new master random seed based on current time -- otherwise uses
+// the same master seed, and thus the same sequence of runs, every time
 func (ss *Sim) NewRndSeed() {
 	ss.RndSeed = time.Now().UnixNano()
 	//fmt.Println(ss.RndSeed)
@@ -438,7 +547,7 @@ func (ss *Sim) SleepCycInit() {
 	}
 	ss.Net.InitActs()
 
-	// Set all layers to random activation
+	// Set all layers to random activation, from the same distribution as the noise (see Slp.Noise)
 	for _, ly := range ss.Net.Layers {
 		for ni := range ly.(*leabra.Layer).Neurons {
 			nrn := &ly.(*leabra.Layer).Neurons[ni]
@@ -447,36 +556,28 @@ func (ss *Sim) SleepCycInit() {
 			}
 			msk := bitflag.Mask32(int(leabra.NeurHasExt))
 			nrn.ClearMask(msk)
-			rnd := rand.Float32()
-			rnd = rnd-0.5
-			if rnd < 0 {
-				rnd = 0
-			}
-			nrn.Act = rnd
-
 		}
+		ss.InjectNoise([]*leabra.Layer{ly.(*leabra.Layer)}, ss.SlpInitRnd, false)
 		ss.UpdateView("sleep")
 	}
 
-	// inc and dec set the rate at which synaptic depression increases and recovers at each synapse
+	// the rates at which synaptic depression increases and recovers are set for each prjn (see PrjnSynDeps)
 	if ss.SynDep {
-		for _, ly := range
-		ss.Net.Layers {
-			inc := 0.0007 
-			dec := 0.0005 
-			ly.(*leabra.Layer).InitSdEffWt(float32(inc), float32(dec))
-		}
+		ss.InitSynDep(true)
 	}
+	ss.SynDepOn = ss.SynDep
 }
 
 // BackToWake terminates sleep and sets the network up for wake training/testing again
 func (ss *Sim) BackToWake() {
-	// Effwt back to =Wt
-	if ss.SynDep {
+	// Effwt back to =Wt -- stages can turn syn dep on and off (see StartSlpStage)
+	if ss.SynDep || len(ss.Slp.Stages) > 0 {
 		for _, ly := range ss.Net.Layers {
 			ly.(*leabra.Layer).TermSdEffWt()
 		}
 	}
+	ss.SynDepOn = false
+	ss.EndCues()
 
 	// Set the input/output/hidden layers back to normal.
 	iolynms := []string{"F1", "F2", "F3", "F4", "F5", "CodeName", "ClassName"}
@@ -618,7 +719,7 @@ func (ss *Sim) AlphaCyc(train bool) {
 		ss.UpdateView("train")
 	}
 	if !train {
-		ss.TstCycPlot.GoUpdate() // make sure up-to-date at end
+		ss.GoUpdatePlot(ss.TstCycPlot) // make sure up-to-date at end
 	}
 }
 
@@ -647,62 +748,16 @@ func (ss *Sim) TrainTrial() {
 		ss.NewRun()
 	}
 
-	// DS: Sleep check needs to be on top because criterion stats only get computed at the end of the epoch
-	// and if check is at the end, one extra trn trial will hapen before sleep
-
-	ss.TrainEnv.Step() // the Env encapsulates and manages all counter state
-
-	// Key to query counters FIRST because current state is in NEXT epoch
-	// if epoch counter has changed
-	epc, _, chg := ss.TrainEnv.Counter(env.Epoch)
-	if chg {
-		ss.LogTrnEpc(ss.TrnEpcLog)
-		if ss.ViewOn && ss.TrainUpdt > leabra.AlphaCycle {
-			ss.UpdateView("train")
-		}
-		if ss.TestInterval > 0 && epc%ss.TestInterval == 0 { // note: epc is *next* so won't trigger first time
-			ss.TestAll()
-
-			if ss.EpcShPctCor >= 0.8 && ss.EpcUnPctCor >= 0.8{
-
-				if ss.ExecSleep{
-					// fmt.Println([]string{strconv.FormatFloat(ss.EpcShPctCor , 'f', 6, 64), strconv.FormatFloat(ss.EpcUnPctCor , 'f', 6, 64), strconv.FormatFloat(ss.EpcShSSE , 'f', 6, 64), strconv.FormatFloat(ss.EpcUnSSE , 'f', 6, 64)})
-					ss.SleepTrial()
-					fmt.Println("Pre-sleep - ")
-					fmt.Println("Shared Pct Correct:", ss.EpcShPctCor)
-					fmt.Println("Unique Pct Correct:", ss.EpcUnPctCor)
-					fmt.Println("Shared SSE:", ss.EpcShSSE)
-					fmt.Println("Unique SSE:", ss.EpcUnSSE)
-					ss.TestAll()
-					fmt.Println("Post-sleep - ")
-					fmt.Println("Shared Pct Correct:", ss.EpcShPctCor)
-					fmt.Println("Unique Pct Correct:", ss.EpcUnPctCor)
-					fmt.Println("Shared SSE:", ss.EpcShSSE)
-					fmt.Println("Unique SSE:", ss.EpcUnSSE)
-				}
-
-				ss.RunEnd()
-				if ss.TrainEnv.Run.Incr() { // we are done!
-					ss.StopNow = true
-					return
-				} else {
-					ss.NeedsNewRun = true
-					return
-				}
-			}
+	if ss.Sleeping || ss.SlpBout > 0 { // finish the sleep bouts that were stopped partway
+		if !ss.SchedSlp {
+			ss.CritReached()
+			return
 		}
-		learned := (ss.NZeroStop > 0 && ss.ShNZero >= ss.NZeroStop && ss.UnNZero >= ss.NZeroStop)
-
-		if learned || epc >= ss.MaxEpcs { // done with training..
-			ss.RunEnd()
-			if ss.TrainEnv.Run.Incr() { // we are done!
-				ss.StopNow = true
-				return
-			} else {
-				ss.NeedsNewRun = true
-				return
-			}
+		if !ss.SchedSleep() { // then goes on with the trial that the env was on
+			return
 		}
+	} else if !ss.TrainStep() {
+		return
 	}
 
 	// Setting up train trial layer input/target chnages in this block
@@ -717,8 +772,8 @@ func (ss *Sim) TrainTrial() {
 	name := (ss.TrainEnv.TrialName.Cur)
 	unique := 0
 	shared := []string{"1", "2", "3", "4", "5", "classname"}
-	r := rand.Float64()
-	r1 := rand.Float64()
+	r := ss.TrainRnd.Float64()
+	r1 := ss.TrainRnd.Float64()
 	outlay := ""
 
 	for i, j := range name {
@@ -736,9 +791,9 @@ func (ss *Sim) TrainTrial() {
 	}
 
 	//Setting ratio for shared:unique feature hiding - fix code here later
-	if r > 0.95 { // shared
+	if r < ss.Task.SharedHideP { // shared
 		ss.HiddenType = "shared"
-		hideindex := int(rand.Intn(len(shared)))
+		hideindex := int(ss.TrainRnd.Intn(len(shared)))
 		ss.HiddenFeature = (shared[hideindex])
 		ss.ShTrlNum++
 	} else { // unique
@@ -749,10 +804,10 @@ func (ss *Sim) TrainTrial() {
 		} else {
 			ss.HiddenType = "unique"
 			ss.UnTrlNum++
-			if r1 > 0.5 {
-				ss.HiddenFeature = strconv.Itoa(unique)
-			} else {
+			if r1 < ss.Task.CodeHideP {
 				ss.HiddenFeature = "codename"
+			} else {
+				ss.HiddenFeature = strconv.Itoa(unique)
 			}
 		}
 
@@ -811,194 +866,338 @@ func (ss *Sim) TrainTrial() {
 	codename.UpdateExtFlags()
 
 	ss.LogTrnTrl(ss.TrnTrlLog)
+	ss.SchedTrls++
 }
 
-// SleepCyc runs one 30,000 cycle trial of sleep
-func (ss *Sim) SleepCyc(c [][]float64) {
+// TrainStep steps the env to the next training trial, and handles the end of each
+// epoch (logging, testing, criterion and the end of the run) and the sleep that
+// is scheduled by Sched.  Returns false if the trial is not to be run -- the run
+// has ended, or a sleep was stopped partway.
+func (ss *Sim) TrainStep() bool {
+	if ss.CkptEpcs > 0 && ss.TrainEnv.Trial.Cur == ss.TrainEnv.Trial.Max-1 && (ss.TrainEnv.Epoch.Cur+1)%ss.CkptEpcs == 0 {
+		ss.AutoCheckpoint() // at the end of the epoch, before its testing
+	}
 
-	viewUpdt := ss.SleepUpdt
+	// DS: Sleep check needs to be on top because criterion stats only get computed at the end of the epoch
+	// and if check is at the end, one extra trn trial will hapen before sleep
 
-	ss.Net.WtFmDWt() // Final weight updating before sleep
+	if ss.TrainEnv.Trial.Cur+1 >= ss.TrainEnv.Trial.Max { // the env permutes its order from the global rand at the end of each epoch
+		WithGlobalRand(func() {
+			rand.Seed(ss.EnvOrderRnd.Int63())
+			ss.TrainEnv.Step()
+		})
+	} else {
+		ss.TrainEnv.Step() // the Env encapsulates and manages all counter state
+	}
 
-	stablecount := 0
-	pluscount := 0
-	minuscount := 0
-	ss.SlpTrls = 0
+	// Key to query counters FIRST because current state is in NEXT epoch
+	// if epoch counter has changed
+	epc, _, chg := ss.TrainEnv.Counter(env.Epoch)
+	if chg {
+		ss.LogTrnEpc(ss.TrnEpcLog)
+		ss.LogPrjnWt(ss.PrjnWtLog, "wake")
+		if ss.ViewOn && ss.TrainUpdt > leabra.AlphaCycle {
+			ss.UpdateView("train")
+		}
+		if ss.TestInterval > 0 && epc%ss.TestInterval == 0 { // note: epc is *next* so won't trigger first time
+			ss.TestAll()
+
+			if ss.EpcShPctCor >= ss.Task.CritShPctCor && ss.EpcUnPctCor >= ss.Task.CritUnPctCor {
+				ss.CritReached()
+				return false
+			}
+		}
+		learned := (ss.NZeroStop > 0 && ss.ShNZero >= ss.NZeroStop && ss.UnNZero >= ss.NZeroStop)
+
+		if learned || epc >= ss.MaxEpcs { // done with training..
+			if ss.SchedSleeps == 0 {
+				ss.SetPreSlpStats()
+			}
+			ss.RunEnd()
+			if ss.TrainEnv.Run.Incr() { // we are done!
+				ss.StopNow = true
+				return false
+			} else {
+				ss.NeedsNewRun = true
+				return false
+			}
+		}
+	}
 
-	// Recording all inhibition Gi parameters prior to sleep for the inhibitory oscillations
-	finhib := ss.Net.LayerByName("F1").(*leabra.Layer).Inhib.Layer.Gi
-	clinhib := ss.Net.LayerByName("ClassName").(*leabra.Layer).Inhib.Layer.Gi
-	coinhib := ss.Net.LayerByName("CodeName").(*leabra.Layer).Inhib.Layer.Gi
-	dginhib := ss.Net.LayerByName("DG").(*leabra.Layer).Inhib.Layer.Gi
-	ca1inhib := ss.Net.LayerByName("CA1").(*leabra.Layer).Inhib.Layer.Gi
-	ca3inhib := ss.Net.LayerByName("CA3").(*leabra.Layer).Inhib.Layer.Gi
+	if ss.SleepDue(chg, epc) {
+		ss.SchedSlp = true
+		return ss.SchedSleep()
+	}
+	return true
+}
 
+// CritReached is called when training reaches criterion: with the crit schedule
+// (see Sched), it sleeps for Slp.Bouts bouts, testing again after each one (if
+// ExecSleep), and then ends the run.  If it is stopped partway, it returns with
+// Sleeping set or SlpBout > 0, and TrainTrial calls it again to finish.
+func (ss *Sim) CritReached() {
+	if ss.ExecSleep && ss.Sched.Mode == "crit" {
+		if !ss.SleepBouts() {
+			return
+		}
+	} else if ss.SchedSleeps == 0 {
+		ss.SetPreSlpStats()
+	}
 
-	ca3 := ss.Net.LayerByName("CA3").(leabra.LeabraLayer).AsLeabra()
-	ca3.RcvPrjns.SendName("CA3").(*hip.CHLPrjn).WtScale.Abs = 2
+	ss.RunEnd()
+	if ss.TrainEnv.Run.Incr() { // we are done!
+		ss.StopNow = true
+	} else {
+		ss.NeedsNewRun = true
+	}
+}
 
-	perlys := []string{"F1", "F2", "F3", "F4", "F5", "ClassName", "CodeName" }
-	for _, ly := range perlys {
-		lyc := ss.Net.LayerByName(ly).(*leabra.Layer).AsLeabra()
-		lycfmca1 := lyc.RcvPrjns.SendName("CA1").(*hip.CHLPrjn)
-		lycfmca1.WtScale.Abs = 2 // Increasing wtscaling from CA1 to perception layers leads to better replays
+// SleepBouts sleeps for Slp.Bouts bouts, testing all the patterns after each one.
+// Returns false if it was stopped partway, with Sleeping set or SlpBout > 0 --
+// calling it again picks up where it left off.
+func (ss *Sim) SleepBouts() bool {
+	for ss.SlpBout < ss.Slp.Bouts {
+		ss.SleepTrial()
+		if ss.Sleeping {
+			return false
+		}
+		ss.SlpBout++
+		if ss.SlpBout == 1 && ss.SchedSleeps == 0 { // first sleep of the run
+			ss.SetPreSlpStats()
+			fmt.Println("Pre-sleep - ")
+			fmt.Println("Shared Pct Correct:", ss.EpcShPctCor)
+			fmt.Println("Unique Pct Correct:", ss.EpcUnPctCor)
+			fmt.Println("Shared SSE:", ss.EpcShSSE)
+			fmt.Println("Unique SSE:", ss.EpcUnSSE)
+		}
+		ss.TestAll()
+		if ss.Slp.Bouts > 1 {
+			fmt.Printf("Post-sleep bout %d - \n", ss.SlpBout)
+		} else {
+			fmt.Println("Post-sleep - ")
+		}
+		fmt.Println("Shared Pct Correct:", ss.EpcShPctCor)
+		fmt.Println("Unique Pct Correct:", ss.EpcUnPctCor)
+		fmt.Println("Shared SSE:", ss.EpcShSSE)
+		fmt.Println("Unique SSE:", ss.EpcUnSSE)
+		if ss.Stopping() && ss.SlpBout < ss.Slp.Bouts { // picks up with the next bout
+			return false
+		}
 	}
+	ss.SlpBout = 0
+	return true
+}
 
-	ss.Net.GScaleFmAvgAct() // update computed scaling factors
-	ss.Net.InitGInc()       // scaling params change, so need to recompute all netins
+// SetPreSlpStats records the current test stats as the ones from before sleep
+func (ss *Sim) SetPreSlpStats() {
+	ss.PreShSSE = ss.EpcShSSE
+	ss.PreShPctCor = ss.EpcShPctCor
+	ss.PreUnSSE = ss.EpcUnSSE
+	ss.PreUnPctCor = ss.EpcUnPctCor
+	ss.PreCuSSE = ss.EpcCuSSE
+	ss.PreCuPctCor = ss.EpcCuPctCor
+	ss.PreUcSSE = ss.EpcUcSSE
+	ss.PreUcPctCor = ss.EpcUcPctCor
+}
 
-	// Loop for the 30,000 cycle sleep trial
-	for cyc := 0; cyc < 30000; cyc++ {
+// SleepCyc runs one trial of sleep, Slp.Cycles long, from cycle SlpCyc onward.
+// If StopNow is set or the sim is interrupted (see Stopping), it stops after the
+// current cycle -- calling it again picks up where it left off.
+func (ss *Sim) SleepCyc(stoscs []StageOscs) {
+
+	viewUpdt := ss.SleepUpdt
+
+	if ss.SlpCyc == 0 {
+		ss.Net.WtFmDWt() // Final weight updating before sleep
+
+		ss.StableCnt = 0
+		ss.PlusCnt = 0
+		ss.MinusCnt = 0
+		ss.SlpTrls = 0
+
+		ss.StabHist = ActHist{}
+		ss.BCMThr = nil
+		ss.PreSlpWts = ss.PrjnWtStats()
+		ss.SlpHomeoN = 0
+		ss.SlpNoiseN = 0
+		ss.PlusEvt.N = 0
+		ss.StableEvt.N = 0
+		ss.RippleEvt.N = 0
+		ss.RippleLeft = 0
+		ss.RippleN = 0
+
+		// Recording all inhibition Gi parameters prior to sleep for the inhibitory oscillations
+		ss.SlpWakeGi = make(map[string]float32, len(ss.Net.Layers))
+		for _, ly := range ss.Net.Layers {
+			ss.SlpWakeGi[ly.Name()] = ly.(*leabra.Layer).Inhib.Layer.Gi
+		}
+	}
+
+	// Loop for the sleep trial -- or for the calibration segment, without learning or logging (see CalibSlpThr)
+	ncyc := ss.Slp.Cycles
+	if ss.SlpCalib {
+		ncyc = ss.Slp.Calib.Cycles
+	}
+	stages := ss.Slp.AllStages()
+	stab := ss.NewStabilityMetric()
+	noiselys := ss.NoiseLayers()
+	for ss.SlpCyc < ncyc {
+		cyc := ss.SlpCyc
+
+		// Each stage sets its own prjn scaling and syn dep as it starts (see Slp.Stages)
+		sti, ult, start := ss.Slp.StageAt(cyc)
+		stage := &stages[sti]
+		ss.SlpUltCyc = ult
+		if start {
+			ss.StartSlpStage(stage)
+		}
+		oscs, lyoscs := stoscs[sti].Oscs, stoscs[sti].LyOscs
 
 		ss.Net.WtFmDWt()
 
+		// Sharp-wave ripples -- brief CA3 recurrent bursts at a phase of the oscillation (see Slp.Ripple)
+		ss.RippleCyc(cyc, stage)
+
+		ss.ApplyCue(cyc, ss.SlpStage)
+		ss.LaySimNaNs()
 		ss.Net.Cycle(&ss.Time, true)
+		ss.SynDepCyc()
 		ss.UpdateView("sleep")
 
 		// Taking the prepared slice of oscil inhib values and producing the oscils in all perlys
 		if ss.InhibOscil {
-			inhibs := c // c is the slice with the sinwave values for the oscillating inhibition
-			ss.InhibFactor = inhibs[0][cyc] // For sleep GUI counter and sleepcyclog
-
-			// Changing Inhibs back to default before next oscill cycle value so that the inhib values are set based on c values
-			perlys := []string{"F1", "F2", "F3", "F4", "F5"}
-			for _, ly := range perlys {
-				ss.Net.LayerByName(ly).(*leabra.Layer).Inhib.Layer.Gi = finhib
+			for i, osc := range oscs {
+				ss.OscVals[i] = osc.Val(cyc)
 			}
-			ss.Net.LayerByName("ClassName").(*leabra.Layer).Inhib.Layer.Gi = clinhib
-			ss.Net.LayerByName("CodeName").(*leabra.Layer).Inhib.Layer.Gi = coinhib
-			ss.Net.LayerByName("DG").(*leabra.Layer).Inhib.Layer.Gi = dginhib
-			ss.Net.LayerByName("CA1").(*leabra.Layer).Inhib.Layer.Gi = ca1inhib
-			ss.Net.LayerByName("CA3").(*leabra.Layer).Inhib.Layer.Gi = ca3inhib
-
-			// Two groups - low layers recieve lower-amplitude inhibitiory oscillations while high layers recive high-amplitude oscillations.
-			// This is done to optimize oscillations for best minus-phases
-			lowlayers := []string{ "ClassName", "CA1", "CodeName"}
-			highlayers := []string{ "F1", "F2", "F3", "F4", "F5", "DG", "CA3"}
-
-			for _, layer := range lowlayers {
-				ly := ss.Net.LayerByName(layer).(*leabra.Layer)
-				ly.Inhib.Layer.Gi = ly.Inhib.Layer.Gi * float32(inhibs[0][cyc])
+			if len(oscs) > 0 {
+				ss.InhibFactor = ss.OscVals[0] // For sleep GUI counter and sleepcyclog
 			}
-			for _, layer := range highlayers {
-				ly := ss.Net.LayerByName(layer).(*leabra.Layer)
-				ly.Inhib.Layer.Gi = ly.Inhib.Layer.Gi * float32(inhibs[1][cyc])
+
+			// Changing Inhibs back to default before next oscill cycle value so that the inhib values are set based on the oscillators
+			ss.RestoreWakeGi()
+
+			// Each group of layers gets its own oscillation (see Slp.OscGroups) -- by default, low layers recieve lower-amplitude
+			// inhibitiory oscillations while high layers recive high-amplitude oscillations, to optimize oscillations for best minus-phases
+			for _, lo := range lyoscs {
+				lo.Layer.Inhib.Layer.Gi = lo.Layer.Inhib.Layer.Gi * float32(lo.Osc.Val(cyc))
 			}
 		}
 
 		// Average network similarity is the "stability" measure. It tracks the cycle-updated temporal auto-correlation of activation values at each layer.
-		avesim := 0.0
-		tmpsim := 0.0
-		for _, lyc := range ss.Net.Layers {
-			ly := ss.Net.LayerByName(lyc.Name()).(*leabra.Layer)
-			tmpsim = ly.Sim
-			if math.IsNaN(tmpsim) {
-				tmpsim = 0
+		// The metric that combines the layers is set by Slp.Stability -- by default, their mean.
+		if len(ss.LaySims) != len(ss.Net.Layers) {
+			ss.LaySims = make([]float64, len(ss.Net.Layers))
+			ss.LayContribs = make([]float64, len(ss.Net.Layers))
+		}
+		for li, lyc := range ss.Net.Layers {
+			ss.LaySims[li] = lyc.(*leabra.Layer).Sim
+			if ss.LayNaN[li] {
+				ss.LaySims[li] = math.NaN()
 			}
-			avesim = avesim + tmpsim
-		}
-		ss.AvgLaySim = avesim / 10
-
-		// If AvgLaySim falls below 0.9 - most likely because a layer has lost all act, random noise will be injected
-		// into the network to get it going again. The first 1000 cycles are skipped to let the network initially settle into an attractor.
-		if ss.Time.Cycle > 200 && ss.AvgLaySim <= 0.8  && (ss.Time.Cycle % 50 == 0 || ss.Time.Cycle % 50 == 1 || ss.Time.Cycle % 50 == 2 || ss.Time.Cycle % 50 == 3 || ss.Time.Cycle % 50 == 4) {
-			for _, ly := range ss.Net.Layers {
-				for ni := range ly.(*leabra.Layer).Neurons {
-					nrn := &ly.(*leabra.Layer).Neurons[ni]
-					if nrn.IsOff() {
-						continue
-					}
-					nrn.Act = 0
-					rnd := rand.Float32()
-					rnd = rnd-0.5
-					if rnd < 0 {
-						rnd = 0
-					}
-					nrn.Act = rnd
-				}
+		}
+		ss.AvgLaySim = stab.Stability(ss.LaySims, ss.LayContribs)
+
+		// If AvgLaySim falls below Slp.Noise.Thr - most likely because a layer has lost all act, random noise will be injected
+		// into the network to get it going again. The first cycles are skipped to let the network initially settle into an attractor.
+		// Slp.Noise can instead inject it periodically or continuously, and sets its distribution, magnitude and layers.
+		ss.SlpNoiseNrns = 0
+		if ss.Slp.Noise.Due(ss.Time.Cycle, ss.AvgLaySim) {
+			ss.SlpNoiseNrns = ss.InjectNoise(noiselys, ss.SlpNoiseRnd, ss.Slp.Noise.Add)
+			ss.SlpNoiseN++
+			if !ss.SlpCalib {
+				ss.RunNoiseN++
 			}
 		}
 
 		// Logging the SlpCycLog
-		ss.LogSlpCyc(ss.SlpCycLog, ss.Time.Cycle)
+		if ss.SlpCalib {
+			if cyc >= ss.Slp.Calib.Skip {
+				ss.CalibSims = append(ss.CalibSims, ss.AvgLaySim)
+			}
+		} else {
+			ss.LogSlpCyc(ss.SlpCycLog, ss.Time.Cycle)
+		}
 
 		// Mark plus or minus phase
-		if ss.SlpLearn {
+		if ss.StageLearn(stage) && !ss.SlpCalib {
 
-			plusthresh := 0.9999938129217251 + 0.0000055 // stability threshold for starting/ending plus phases
-			minusthresh := 0.9999938129217251 - 0.001 // threshold to end minus phases
+			plusthresh := ss.PlusThr   // stability threshold for starting/ending plus phases
+			minusthresh := ss.MinusThr // threshold to end minus phases
 
 			// Checking if stable above threshold
 			if ss.PlusPhase == false && ss.MinusPhase == false {
 				if ss.AvgLaySim >= plusthresh {
-					stablecount++
+					ss.StableCnt++
 				} else if ss.AvgLaySim < plusthresh {
-					stablecount = 0
+					ss.StableCnt = 0
 				}
 			}
 
 			// For a dual threshold model, checking here if network has been stable above plusthresh for 5 cycles
 			// Starting plus phase if criterion met
-			if stablecount == 5 && ss.AvgLaySim >= plusthresh && ss.PlusPhase == false && ss.MinusPhase == false {
-				stablecount = 0
-				minuscount = 0
+			if ss.StableCnt == ss.Slp.StableCycs && ss.AvgLaySim >= plusthresh && ss.PlusPhase == false && ss.MinusPhase == false {
+				ss.StableCnt = 0
+				ss.MinusCnt = 0
 				ss.PlusPhase = true
-				pluscount++
+				ss.PlusCnt++
 				for _, ly := range ss.Net.Layers {
 					ly.(leabra.LeabraLayer).AsLeabra().RunSumUpdt(true)
 				}
+				ss.StartPlusPhase(cyc)
 			// Continuing plus phase
-			} else if pluscount > 0 && ss.AvgLaySim >= plusthresh && ss.PlusPhase == true {
-				pluscount++
+			} else if ss.PlusCnt > 0 && ss.AvgLaySim >= plusthresh && ss.PlusPhase == true {
+				ss.PlusCnt++
 				for _, ly := range ss.Net.Layers {
 					ly.(leabra.LeabraLayer).AsLeabra().RunSumUpdt(false)
 				}
+				ss.ActSum(&ss.PlusActs, false)
 			// If stabilty measure falls below plus threshold, plus phase ends and minus phase begins
 			} else if ss.AvgLaySim < plusthresh && ss.AvgLaySim >= minusthresh && ss.PlusPhase == true {
 				ss.PlusPhase = false
 				ss.MinusPhase = true
-				minuscount++
+				ss.MinusCnt++
 
 				for _, ly := range ss.Net.Layers {
-					ly.(leabra.LeabraLayer).AsLeabra().CalcActP(pluscount)
+					ly.(leabra.LeabraLayer).AsLeabra().CalcActP(ss.PlusCnt)
 					ly.(leabra.LeabraLayer).AsLeabra().RunSumUpdt(true)
 				}
-				pluscount = 0
+				ss.PlusDWt(ss.PlusCnt) // Weight changes of the hebb and bcm rules
+				ss.EndPlusPhase(ss.PlusCnt)
+				ss.PlusCnt = 0
 			// Continuing minus phase
 			} else if ss.AvgLaySim >= minusthresh && ss.MinusPhase == true {
-				minuscount++
+				ss.MinusCnt++
 				for _, ly := range ss.Net.Layers {
 					ly.(leabra.LeabraLayer).AsLeabra().RunSumUpdt(false)
 				}
+				ss.ActSum(&ss.MinusActs, false)
 			//	If stability measure falls below minus threshold, minus phase ends
 			} else if ss.AvgLaySim < minusthresh && ss.MinusPhase == true {
 				ss.MinusPhase = false
 
 				for _, ly := range ss.Net.Layers {
-					ly.(leabra.LeabraLayer).AsLeabra().CalcActM(minuscount)
-				}
-				minuscount = 0
-				stablecount = 0
-
-				for _, lyc := range ss.Net.Layers {
-					ss.SlpTrls++
-					ly := ss.Net.LayerByName(lyc.Name()).(*leabra.Layer)
-					for _, p := range ly.SndPrjns {
-						if p.IsOff() {
-							continue
-						}
-						p.(*hip.CHLPrjn).SlpDWt() // Weight changes occuring here
-					}
+					ly.(leabra.LeabraLayer).AsLeabra().CalcActM(ss.MinusCnt)
 				}
+				ss.MinusDWt() // Weight changes occuring here, by the rule of each prjn (see SlpPlasts)
+				ss.SlpTrls++
+				ss.EndMinusPhase(cyc, ss.MinusCnt) // Logging the completed plus / minus pair in the SlpPhaseLog
+				ss.MinusCnt = 0
+				ss.StableCnt = 0
 			// Catching the rare occasion where stabilty drops in one cycle from above the plus threshold to below the minus threshold - ending trial if this happens
 			} else if ss.AvgLaySim < minusthresh && ss.PlusPhase == true {
 				ss.PlusPhase = false
-				pluscount = 0
-				stablecount = 0
-				minuscount = 0
+				ss.PlusCnt = 0
+				ss.StableCnt = 0
+				ss.MinusCnt = 0
 			}
 		}
 
+		// Synaptic homeostasis -- global downscaling of the weights, alongside or instead of the learning above (see Slp.Homeo)
+		ss.HomeoCyc(cyc, ss.SlpStage)
+
+		// Decoding what is being replayed
+		ss.ReplayCyc(cyc)
+
 		// Forward the cycle timer
 		ss.Time.CycleInc()
 
@@ -1021,16 +1220,40 @@ func (ss *Sim) SleepCyc(c [][]float64) {
 				}
 			}
 		}
+
+		ss.SlpCyc++
+		if ss.Slp.WtLogCycs > 0 && ss.SlpCyc%ss.Slp.WtLogCycs == 0 && ss.SlpCyc < ncyc && !ss.SlpCalib {
+			ss.LogPrjnWt(ss.PrjnWtLog, "sleep")
+		}
+		if ss.Stopping() && ss.SlpCyc < ncyc && !ss.SlpCalib {
+			return
+		}
+		if ss.CkptSlpCycs > 0 && ss.SlpCyc%ss.CkptSlpCycs == 0 && ss.SlpCyc < ncyc && !ss.SlpCalib {
+			ss.AutoCheckpoint()
+		}
 	}
 
+	ss.EndReplay(ss.SlpCyc)
+
 	// Reset sleep algorithm variables
-	pluscount = 0
-	minuscount = 0
+	ss.PlusCnt = 0
+	ss.MinusCnt = 0
 	ss.MinusPhase = false
 	ss.PlusPhase = false
-	stablecount = 0
+	ss.StableCnt = 0
+
+	ss.SleepCycEnd()
 
-	perlys = []string{"F1", "F2", "F3", "F4", "F5", "CodeName", "ClassName"}
+	if ss.ViewOn {
+		ss.UpdateView("sleep")
+	}
+}
+
+// SleepCycEnd sets the prjn scaling and layer inhibition that SleepCyc changed
+// back to their wake values
+func (ss *Sim) SleepCycEnd() {
+	ca3 := ss.Net.LayerByName("CA3").(leabra.LeabraLayer).AsLeabra()
+	perlys := []string{"F1", "F2", "F3", "F4", "F5", "CodeName", "ClassName"}
 	for _, ly := range perlys {
 		lyc := ss.Net.LayerByName(ly).(*leabra.Layer).AsLeabra()
 		lycfmca1 := lyc.RcvPrjns.SendName("CA1").(*hip.CHLPrjn)
@@ -1045,49 +1268,76 @@ func (ss *Sim) SleepCyc(c [][]float64) {
 	ss.Net.GScaleFmAvgAct() // update computed scaling factors
 	ss.Net.InitGInc()       // scaling params change, so need to recompute all netins
 
-	perlys = []string{"F1", "F2", "F3", "F4", "F5"}
-	for _, ly := range perlys {
-		ss.Net.LayerByName(ly).(*leabra.Layer).Inhib.Layer.Gi = finhib
-	}
-
-	ss.Net.LayerByName("ClassName").(*leabra.Layer).Inhib.Layer.Gi = clinhib
-	ss.Net.LayerByName("CodeName").(*leabra.Layer).Inhib.Layer.Gi = coinhib
-	ss.Net.LayerByName("DG").(*leabra.Layer).Inhib.Layer.Gi = dginhib
-	ss.Net.LayerByName("CA1").(*leabra.Layer).Inhib.Layer.Gi = ca1inhib
+	ss.RestoreWakeGi()
+}
 
-	if ss.ViewOn {
-		ss.UpdateView("sleep")
+// RestoreWakeGi sets the Inhib.Layer.Gi of each layer back to its value from before sleep
+func (ss *Sim) RestoreWakeGi() {
+	for _, ly := range ss.Net.Layers {
+		if gi, ok := ss.SlpWakeGi[ly.Name()]; ok {
+			ly.(*leabra.Layer).Inhib.Layer.Gi = gi
+		}
 	}
 }
 
-// SleepTrial sets up one sleep trial
+// SleepTrial sets up one sleep trial, or picks up a sleep trial that was stopped
+// partway, in which case Sleeping is still set when it returns
 func (ss *Sim) SleepTrial() {
-	ss.SleepCycInit()
-	ss.UpdateView("sleep")
-
-	// DS added for inhib oscill
-	start := 0.
-	stop := 10000.
-	step := 0.1
-
-	N := int(math.Ceil((stop - start) / step))
-	rnge := make([]float64, N)
-	for x := range rnge {
-		rnge[x] = start + step*float64(x)
-	}
-	a := rnge
-	c := make([][]float64, 2)
-	for i := 0; i < 100000; i++ {
-		c[0] = append(c[0], (math.Cos(a[i]/1)/80 + 0.99)) //low oscillation
-		c[1] = append(c[1], (math.Cos(a[i]/1)/30 + 0.99)) //high oscillation
-	}
-	ss.SleepCyc(c)
-	ss.SlpCycPlot.GoUpdate()
+	sdps, err := ss.PrjnSynDeps(&ss.Slp, ss.ParamSet, ss.LogSetParams)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not set the syn dep params: %v\n", err)
+		ss.StopNow = true
+		return
+	}
+	ss.SlpSynDeps = sdps
+	pps, err := ss.PrjnPlasticities(&ss.Slp, ss.ParamSet, ss.LogSetParams)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not set the sleep learning rules: %v\n", err)
+		ss.StopNow = true
+		return
+	}
+	ss.SlpPlasts = pps
+	ss.ReplayDecItems = ss.ReplayItems()
+	cpats, err := ss.CuePatterns()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not make the sleep cues: %v\n", err)
+		ss.StopNow = true
+		return
+	}
+	ss.CuePats = cpats
+	ss.StartCues()
+
+	// DS added for inhib oscill -- one oscillator per layer group
+	sp := &ss.Slp
+	stoscs, err := ss.SlpStageOscs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not make sleep oscillations: %v\n", err)
+		ss.StopNow = true
+		return
+	}
+	ss.OscVals = make([]float64, len(ss.Slp.OscGroups))
+	if !ss.Sleeping {
+		ss.SetSlpThr(stoscs)
+		ss.SleepCycInit()
+		ss.UpdateView("sleep")
+		ss.Sleeping = true
+		ss.SlpCyc = 0
+	}
+	ss.SleepCyc(stoscs)
+	if ss.SlpCyc < sp.Cycles { // stopped partway
+		return
+	}
+	ss.LogPrjnWt(ss.PrjnWtLog, "sleep")
+	ss.Sleeping = false
+	ss.SlpCyc = 0
+	ss.GoUpdatePlot(ss.SlpCycPlot)
+	ss.LogSlpWt(ss.SlpWtLog)
 	ss.BackToWake()
 }
 
 // RunEnd is called at the end of a run -- save weights, record final log, etc here
 func (ss *Sim) RunEnd() {
+	ss.LogRun(ss.RunLog)
 	if ss.SaveWts {
 		fnm := ss.WeightsFileName()
 		fmt.Printf("Saving Weights to: %v\n", fnm)
@@ -1098,8 +1348,25 @@ func (ss *Sim) RunEnd() {
 // NewRun intializes a new run of the model, using the TrainEnv.Run counter
 // for the new run value
 func (ss *Sim) NewRun() {
-	ss.NewRndSeed()
 	run := ss.TrainEnv.Run.Cur
+	if ss.Sleeping { // abandon a sleep trial that was stopped partway
+		ss.SleepCycEnd()
+		ss.BackToWake()
+		ss.Sleeping = false
+		ss.SlpCyc = 0
+		ss.PlusPhase = false
+		ss.MinusPhase = false
+	}
+	ss.SlpBout = 0
+	ss.SchedSlp = false
+	ss.SchedSleeps = 0
+	ss.SchedTrls = 0
+	ss.PlusThr, ss.MinusThr = ss.Slp.PlusThr, ss.Slp.MinusThr
+	ss.SlpCalibrated = false
+	ss.RunNoiseN = 0
+	ss.InitRunSeeds()
+	GlobalRandMu.Lock() // everything from here to InitWts uses the global rand -- see WithGlobalRand
+	rand.Seed(ss.RunSeeds["Env"])
 	ss.TrainEnv.Table = etable.NewIdxView(ss.TrainSat)
 	ss.TrainEnv.Init(run)
 	ss.TestEnv.Init(run)
@@ -1109,35 +1376,47 @@ func (ss *Sim) NewRun() {
 	ss.TrnTrlLog.SetNumRows(0)
 	ss.TrnEpcLog.SetNumRows(0)
 	ss.TstEpcLog.SetNumRows(0)
+	ss.ReplayLog.SetNumRows(0)
+	ss.SlpWtLog.SetNumRows(0)
+	ss.SlpPhaseLog.SetNumRows(0)
+	ss.PrjnWtLog.SetNumRows(0)
 	ss.NeedsNewRun = false
 
 	dg := ss.Net.LayerByName("DG").(*leabra.Layer)
 	ca3 := ss.Net.LayerByName("CA3").(*leabra.Layer)
 
 	pjdgca3 := ca3.RcvPrjns.SendName("DG").(*hip.CHLPrjn)
-	pjdgca3.Pattern().(*prjn.UnifRnd).RndSeed = ss.RndSeed
+	pjdgca3.Pattern().(*prjn.UnifRnd).RndSeed = ss.RunSeeds["DGToCA3"]
 	pjdgca3.Build()
 
 	perlys := []string{"F1", "F2", "F3", "F4", "F5", "ClassName", "CodeName"}
 	for _, layer := range perlys {
-		time.Sleep(1)
-		ss.NewRndSeed()
-
 		pjperca3 := ca3.RcvPrjns.SendName(layer).(*hip.CHLPrjn)
-		pjperca3.Pattern().(*prjn.UnifRnd).RndSeed = ss.RndSeed
+		pjperca3.Pattern().(*prjn.UnifRnd).RndSeed = ss.RunSeeds[layer+"ToHip"]
 		pjperca3.Build()
 
 		pjperdg := dg.RcvPrjns.SendName(layer).(*hip.CHLPrjn)
-		pjperdg.Pattern().(*prjn.UnifRnd).RndSeed = ss.RndSeed
+		pjperdg.Pattern().(*prjn.UnifRnd).RndSeed = ss.RunSeeds[layer+"ToHip"]
 		pjperdg.Build()
 	}
 
+	rand.Seed(ss.RunSeeds["Wts"]) // UnifRnd reseeds the global rand when building -- take it back for InitWts
 	ss.Net.InitWts()
+	GlobalRandMu.Unlock()
 
+	// InitWts leaves the pool activity stats from the last trial of the previous run, which
+	// AlphaCycInit uses to update the running averages -- reset them so a run only depends on its seeds
+	for _, ly := range ss.Net.Layers {
+		pools := ly.(leabra.LeabraLayer).AsLeabra().Pools
+		for pi := range pools {
+			pools[pi].ActM = minmax.AvgMax32{}
+			pools[pi].ActP = minmax.AvgMax32{}
+		}
+	}
+	ss.WtSnap = ss.PrjnWts()
 
 	ss.TrainEnv.Trial.Max = ss.TrialPerEpc
 
-	fmt.Println(ss.TrainEnv.Run.Cur)
 
 }
 
@@ -1213,7 +1492,7 @@ func (ss *Sim) TrainEpoch() {
 	curTrial := ss.TrainEnv.Trial.Cur
 	for {
 		ss.TrainTrial()
-		if ss.StopNow || ss.TrainEnv.Epoch.Cur != curEpc || curTrial == ss.TrialPerEpc {
+		if ss.Stopping() || ss.TrainEnv.Epoch.Cur != curEpc || curTrial == ss.TrialPerEpc {
 			break
 		}
 	}
@@ -1226,7 +1505,7 @@ func (ss *Sim) TrainRun() {
 	curRun := ss.TrainEnv.Run.Cur
 	for {
 		ss.TrainTrial()
-		if ss.StopNow || ss.TrainEnv.Run.Cur != curRun {
+		if ss.Stopping() || ss.TrainEnv.Run.Cur != curRun {
 			break
 		}
 	}
@@ -1238,7 +1517,7 @@ func (ss *Sim) Train() {
 	ss.StopNow = false
 	for {
 		ss.TrainTrial()
-		if ss.StopNow {
+		if ss.Stopping() {
 			break
 		}
 	}
@@ -1270,12 +1549,25 @@ func (ss *Sim) SaveWeights(filename gi.FileName) {
 	ss.Net.SaveWtsJSON(filename)
 }
 
+// OpenWeights loads network weights saved by SaveWeights -- the network must have
+// been built with the same master seed and run as when they were saved, so that the
+// random DG / CA3 connectivity matches the saved synapses
+func (ss *Sim) OpenWeights(filename gi.FileName) error {
+	err := ss.Net.OpenWtsJSON(filename)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	ss.WtSnap = ss.PrjnWts() // weight changes are from the loaded weights
+	return nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////////////////
 // Testing
 
 // TestTrial runs one trial of testing -- always sequentially presented inputs
 func (ss *Sim) TestTrial(returnOnChg bool) {
-	ss.TestEnv.Step()
+	WithGlobalRand(func() { ss.TestEnv.Step() }) // sequential, but still permutes at the end
 
 	// Query counters FIRST
 	_, _, chg := ss.TestEnv.Counter(env.Epoch)
@@ -1342,7 +1634,7 @@ func (ss *Sim) TestAll() {
 
 	ss.TestNm = "Train Sat Permutations"
 	ss.TestEnv.Table = etable.NewIdxView(ss.TestSat)
-	ss.TestEnv.Init(ss.TrainEnv.Run.Cur)
+	WithGlobalRand(func() { ss.TestEnv.Init(ss.TrainEnv.Run.Cur) })
 
 	ss.HiddenType = ""
 	ss.HiddenFeature = ""
@@ -1425,7 +1717,7 @@ func (ss *Sim) TestAll() {
 			codename.UpdateExtFlags()
 
 			_, _, chg := ss.TestEnv.Counter(env.Epoch)
-			if chg || ss.StopNow {
+			if chg || ss.StopNow { // not Stopping: finish the test if interrupted, so a checkpoint can be saved after it
 				break
 			}
 
@@ -1434,6 +1726,7 @@ func (ss *Sim) TestAll() {
 			} else {
 				ss.ShTrlNum++
 			}
+			ss.CueTrialStats(name)
 		}
 	}
 
@@ -1468,7 +1761,7 @@ func (ss *Sim) ParamsName() string {
 func (ss *Sim) SetParams(sheet string, setMsg bool) error {
 	if sheet == "" {
 		// this is important for catching typos and ensuring that all sheets can be used
-		ss.Params.ValidateSheets([]string{"Network", "Sim"})
+		ss.Params.ValidateSheets([]string{"Network", "Sim", "SynDep", "Plasticity"})
 	}
 	err := ss.SetParamsSet("Base", sheet, setMsg)
 	if ss.ParamSet != "" && ss.ParamSet != "Base" {
@@ -1515,8 +1808,8 @@ func (ss *Sim) OpenPat(dt *etable.Table, fname, name, desc string) {
 }
 
 func (ss *Sim) OpenPats() {
-	ss.OpenPat(ss.TrainSat, "Train_Sats_go.txt", "TrainSat", "Training Patterns")
-	ss.OpenPat(ss.TestSat, "Test_Sats_go.txt", "TestSat", "Testing Patterns")
+	ss.OpenPat(ss.TrainSat, ss.Task.TrainPats, "TrainSat", "Training Patterns")
+	ss.OpenPat(ss.TestSat, ss.Task.TestPats, "TestSat", "Testing Patterns")
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////
@@ -1540,12 +1833,122 @@ func (ss *Sim) RunEpochName(run, epc int) string {
 
 // WeightsFileName returns default current weights file name
 func (ss *Sim) WeightsFileName() string {
-	return ss.Net.Nm + "_" + ss.RunName() + "_" + ss.RunEpochName(ss.TrainEnv.Run.Cur, ss.TrainEnv.Epoch.Cur) + ".wts"
+	return ss.OutFile(ss.Net.Nm + "_" + ss.RunName() + "_" + ss.RunEpochName(ss.TrainEnv.Run.Cur, ss.TrainEnv.Epoch.Cur) + ".wts")
 }
 
 // LogFileName returns default log file name
 func (ss *Sim) LogFileName(lognm string) string {
-	return ss.Net.Nm + "_" + ss.RunName() + "_" + lognm + ".csv"
+	return ss.OutFile(ss.Net.Nm + "_" + ss.RunName() + ss.LogSfx + "_" + lognm + ".tsv")
+}
+
+// OpenLogFile creates the file for streaming the given log to, returning nil
+// (after reporting the error) if it can't be created.  If resuming from a
+// checkpoint that had this log open (see LogOffs), the existing file is instead
+// cut back to where it was at the checkpoint and appended to from there.
+func (ss *Sim) OpenLogFile(lognm string) *os.File {
+	fnm := ss.LogFileName(lognm)
+	if off, has := ss.LogOffs[lognm]; has {
+		fp, err := os.OpenFile(fnm, os.O_RDWR, 0666)
+		if err == nil {
+			fi, _ := fp.Stat()
+			if fi.Size() < off {
+				err = fmt.Errorf("%s: log file is shorter than at the checkpoint", fnm)
+			} else if err = fp.Truncate(off); err == nil {
+				_, err = fp.Seek(off, io.SeekStart)
+			}
+			if err != nil {
+				fp.Close()
+			}
+		}
+		if err != nil {
+			log.Println(err)
+			return nil
+		}
+		fmt.Printf("Resuming %s log in: %v\n", lognm, fnm)
+		return fp
+	}
+	fp, err := os.Create(fnm)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	fmt.Printf("Saving %s log to: %v\n", lognm, fnm)
+	return fp
+}
+
+// LogFileSlots returns the file that each streamed log is written to, keyed by
+// the short log name used for its -<name>log command-line flag and file name
+func (ss *Sim) LogFileSlots() map[string]**os.File {
+	return map[string]**os.File{
+		"trntrl":   &ss.TrnTrlFile,
+		"epc":      &ss.TrnEpcFile,
+		"tsttrl":   &ss.TstTrlFile,
+		"tstepc":   &ss.TstEpcFile,
+		"tstcyc":   &ss.TstCycFile,
+		"slpcyc":   &ss.SlpCycFile,
+		"replay":   &ss.ReplayFile,
+		"slpwt":    &ss.SlpWtFile,
+		"slpphase": &ss.SlpPhaseFile,
+		"prjnwt":   &ss.PrjnWtFile,
+		"run":      &ss.RunFile,
+	}
+}
+
+// LogTables returns the table of each log, keyed the same as LogFileSlots
+func (ss *Sim) LogTables() map[string]*etable.Table {
+	return map[string]*etable.Table{
+		"trntrl":   ss.TrnTrlLog,
+		"epc":      ss.TrnEpcLog,
+		"tsttrl":   ss.TstTrlLog,
+		"tstepc":   ss.TstEpcLog,
+		"tstcyc":   ss.TstCycLog,
+		"slpcyc":   ss.SlpCycLog,
+		"replay":   ss.ReplayLog,
+		"slpwt":    ss.SlpWtLog,
+		"slpphase": ss.SlpPhaseLog,
+		"prjnwt":   ss.PrjnWtLog,
+		"run":      ss.RunLog,
+	}
+}
+
+// OpenLogFiles opens the file for each of the named logs (see LogFileSlots)
+func (ss *Sim) OpenLogFiles(lognms []string) {
+	slots := ss.LogFileSlots()
+	for _, lnm := range lognms {
+		*slots[lnm] = ss.OpenLogFile(lnm)
+	}
+}
+
+// CloseLogFiles closes all the open log files
+func (ss *Sim) CloseLogFiles() {
+	for _, fp := range ss.LogFileSlots() {
+		if *fp != nil {
+			(*fp).Close()
+			*fp = nil
+		}
+	}
+}
+
+// WriteLogRow streams given row of the log table to the file, if it is open.
+// Column headers are written first if nothing has gone into the file yet --
+// logs that reset their rows (e.g., per run) just keep appending to the file.
+func WriteLogRow(fp *os.File, dt *etable.Table, row int) {
+	if fp == nil {
+		return
+	}
+	if off, _ := fp.Seek(0, io.SeekCurrent); off == 0 {
+		dt.WriteCSVHeaders(fp, etable.Tab)
+	}
+	dt.WriteCSVRow(fp, row, etable.Tab)
+}
+
+// GoUpdatePlot updates given plot from the running goroutine -- skipped when
+// there is no window to show it in (e.g., running from the command line)
+func (ss *Sim) GoUpdatePlot(plt *eplot.Plot2D) {
+	if ss.Win == nil || plt == nil {
+		return
+	}
+	plt.GoUpdate()
 }
 
 //////////////////////////////////////////////
@@ -1574,7 +1977,8 @@ func (ss *Sim) LogTrnTrl(dt *etable.Table) {
 	dt.SetCellFloat("CosDiff", row, ss.TrlCosDiff)
 
 	// note: essential to use Go version of update when called from another goroutine
-	ss.TrnTrlPlot.GoUpdate()
+	ss.GoUpdatePlot(ss.TrnTrlPlot)
+	WriteLogRow(ss.TrnTrlFile, dt, row)
 }
 
 func (ss *Sim) ConfigTrnTrlLog(dt *etable.Table) {
@@ -1625,20 +2029,42 @@ func (ss *Sim) LogSlpCyc(dt *etable.Table, cyc int) {
 	}
 	dt.SetNumRows(row + 1)
 
-	dt.SetCellFloat("Cycle", cyc, float64(cyc))
-	dt.SetCellFloat("InhibFactor", cyc, float64(ss.InhibFactor))
-	dt.SetCellFloat("AvgLaySim", cyc, float64(ss.AvgLaySim))
+	dt.SetCellFloat("Bout", row, float64(ss.SlpBout+1))
+	dt.SetCellFloat("Cycle", row, float64(cyc))
+	dt.SetCellString("Stage", row, ss.SlpStage)
+	dt.SetCellFloat("UltCycle", row, float64(ss.SlpUltCyc))
+	dt.SetCellFloat("InhibFactor", row, float64(ss.InhibFactor))
+	dt.SetCellFloat("AvgLaySim", row, float64(ss.AvgLaySim))
+	for i, gp := range ss.Slp.OscGroups.Names() {
+		if i < len(ss.OscVals) {
+			dt.SetCellFloat(gp+"Osc", row, ss.OscVals[i])
+		}
+	}
 
-	for _, ly := range ss.Net.Layers {
+	for li, ly := range ss.Net.Layers {
 		lyc := ss.Net.LayerByName(ly.Name()).(leabra.LeabraLayer).AsLeabra()
 		dt.SetCellFloat(ly.Name()+" Sim", row, float64(lyc.Sim))
+		if li < len(ss.LayContribs) {
+			dt.SetCellFloat(ly.Name()+" Contrib", row, ss.LayContribs[li])
+		}
 	}
-
-	ss.SlpCycPlot.GoUpdate()
-
-	if cyc%10 == 0 { // too slow to do every cyc
-		// note: essential to use Go version of update when called from another goroutine
+	dt.SetCellString("NaNLays", row, ss.NaNLayers())
+	dt.SetCellString("Cue", row, ss.CueItem)
+	ripple := 0
+	if ss.RippleLeft > 0 {
+		ripple = 1
+	}
+	dt.SetCellFloat("Ripple", row, float64(ripple))
+	dt.SetCellFloat("NoiseNrns", row, float64(ss.SlpNoiseNrns))
+	dt.SetCellFloat("NoiseN", row, float64(ss.SlpNoiseN))
+	for i, pd := range ss.SlpSynDeps {
+		if i < len(ss.PrjnDep) {
+			dt.SetCellFloat(pd.Name()+" Dep", row, ss.PrjnDep[i])
+		}
 	}
+
+	ss.GoUpdatePlot(ss.SlpCycPlot)
+	WriteLogRow(ss.SlpCycFile, dt, row)
 }
 
 //DZ added
@@ -1648,17 +2074,34 @@ func (ss *Sim) ConfigSlpCycLog(dt *etable.Table) {
 	dt.SetMetaData("read-only", "true")
 	dt.SetMetaData("precision", strconv.Itoa(LogPrec))
 
-	np := ss.MaxSlpCyc // max cycles
+	np := ss.Slp.Cycles // max cycles
 
 	sch := etable.Schema{
+		{"Bout", etensor.INT64, nil, nil},
 		{"Cycle", etensor.INT64, nil, nil},
+		{"Stage", etensor.STRING, nil, nil},
+		{"UltCycle", etensor.INT64, nil, nil},
 		{"InhibFactor", etensor.FLOAT64, nil, nil},
 		{"AvgLaySim", etensor.FLOAT64, nil, nil},
 	}
+	for _, gp := range ss.Slp.OscGroups.Names() {
+		sch = append(sch, etable.Column{gp + "Osc", etensor.FLOAT64, nil, nil})
+	}
 
 	for _, ly := range ss.Net.Layers {
 		sch = append(sch, etable.Column{ly.Name() + " Sim", etensor.FLOAT64, nil, nil})
 	}
+	for _, ly := range ss.Net.Layers {
+		sch = append(sch, etable.Column{ly.Name() + " Contrib", etensor.FLOAT64, nil, nil})
+	}
+	sch = append(sch, etable.Column{"NaNLays", etensor.STRING, nil, nil})
+	sch = append(sch, etable.Column{"Cue", etensor.STRING, nil, nil})
+	sch = append(sch, etable.Column{"Ripple", etensor.INT64, nil, nil})
+	sch = append(sch, etable.Column{"NoiseNrns", etensor.INT64, nil, nil})
+	sch = append(sch, etable.Column{"NoiseN", etensor.INT64, nil, nil})
+	for _, pj := range ss.SynDepPrjns() {
+		sch = append(sch, etable.Column{pj.Name() + " Dep", etensor.FLOAT64, nil, nil})
+	}
 
 	dt.SetFromSchema(sch, np)
 }
@@ -1715,6 +2158,7 @@ func (ss *Sim) LogTrnEpc(dt *etable.Table) {
 	// Adding shared/unique metrics to log
 	dt.SetCellFloat("Run", row, float64(ss.TrainEnv.Run.Cur))
 	dt.SetCellFloat("Epoch", row, float64(epc))
+	dt.SetCellFloat("Sleeps", row, float64(ss.SchedSleeps))
 	dt.SetCellFloat("Total Trials", row, float64(nt))
 	dt.SetCellFloat("Shared Trials", row, float64(shnt))
 	dt.SetCellFloat("ShSSE", row, ss.EpcShSSE)
@@ -1735,7 +2179,8 @@ func (ss *Sim) LogTrnEpc(dt *etable.Table) {
 	}
 
 	// note: essential to use Go version of update when called from another goroutine
-	ss.TrnEpcPlot.GoUpdate()
+	ss.GoUpdatePlot(ss.TrnEpcPlot)
+	WriteLogRow(ss.TrnEpcFile, dt, row)
 
 	if ss.EpcUnSSE == 0 && ss.EpcShSSE == 0 {
 		ss.ZError++
@@ -1754,6 +2199,7 @@ func (ss *Sim) ConfigTrnEpcLog(dt *etable.Table) {
 	sch := etable.Schema{
 		{"Run", etensor.INT64, nil, nil},
 		{"Epoch", etensor.INT64, nil, nil},
+		{"Sleeps", etensor.INT64, nil, nil},
 		{"Total Trials", etensor.INT64, nil, nil},
 		{"Shared Trials", etensor.INT64, nil, nil},
 		{"ShSSE", etensor.FLOAT64, nil, nil},
@@ -1842,7 +2288,8 @@ func (ss *Sim) LogTstTrl(dt *etable.Table) {
 	}
 
 	// note: essential to use Go version of update when called from another goroutine
-	ss.TstTrlPlot.GoUpdate()
+	ss.GoUpdatePlot(ss.TstTrlPlot)
+	WriteLogRow(ss.TstTrlFile, dt, row)
 }
 
 func (ss *Sim) ConfigTstTrlLog(dt *etable.Table) {
@@ -1949,11 +2396,13 @@ func (ss *Sim) LogTstEpc(dt *etable.Table) {
 	ss.EpcUnCosDiff = ss.UnSumCosDiff / unnt
 	ss.UnSumCosDiff = 0
 	ss.UnTrlNum = 0
+	ss.CueEpcStats()
 
 	// note: this shows how to use agg methods to compute summary data from another
 	// data table, instead of incrementing on the Sim
 	dt.SetCellFloat("Run", row, float64(ss.TrainEnv.Run.Cur))
 	dt.SetCellFloat("Epoch", row, float64(epc))
+	dt.SetCellFloat("SlpBouts", row, float64(ss.SlpBout))
 	dt.SetCellFloat("Total Trials", row, float64(nt))
 	dt.SetCellFloat("Shared Trials", row, float64(shnt))
 	dt.SetCellFloat("ShSSE", row, ss.EpcShSSE)
@@ -1967,6 +2416,10 @@ func (ss *Sim) LogTstEpc(dt *etable.Table) {
 	dt.SetCellFloat("UnPctErr", row, ss.EpcUnPctErr)
 	dt.SetCellFloat("UnPctCor", row, ss.EpcUnPctCor)
 	dt.SetCellFloat("UnCosDiff", row, ss.EpcUnCosDiff)
+	dt.SetCellFloat("CuSSE", row, ss.EpcCuSSE)
+	dt.SetCellFloat("CuPctCor", row, ss.EpcCuPctCor)
+	dt.SetCellFloat("UcSSE", row, ss.EpcUcSSE)
+	dt.SetCellFloat("UcPctCor", row, ss.EpcUcPctCor)
 
 	/*
 		trix := etable.NewIdxView(trl)
@@ -1997,7 +2450,8 @@ func (ss *Sim) LogTstEpc(dt *etable.Table) {
 	//}
 
 	// note: essential to use Go version of update when called from another goroutine
-	ss.TstEpcPlot.GoUpdate()
+	ss.GoUpdatePlot(ss.TstEpcPlot)
+	WriteLogRow(ss.TstEpcFile, dt, row)
 }
 
 func (ss *Sim) ConfigTstEpcLog(dt *etable.Table) {
@@ -2009,6 +2463,7 @@ func (ss *Sim) ConfigTstEpcLog(dt *etable.Table) {
 	sch := etable.Schema{
 		{"Run", etensor.INT64, nil, nil},
 		{"Epoch", etensor.INT64, nil, nil},
+		{"SlpBouts", etensor.INT64, nil, nil},
 		{"Total Trials", etensor.INT64, nil, nil},
 		{"Shared Trials", etensor.INT64, nil, nil},
 		{"ShSSE", etensor.FLOAT64, nil, nil},
@@ -2022,6 +2477,10 @@ func (ss *Sim) ConfigTstEpcLog(dt *etable.Table) {
 		{"UnPctErr", etensor.FLOAT64, nil, nil},
 		{"UnPctCor", etensor.FLOAT64, nil, nil},
 		{"UnCosDiff", etensor.FLOAT64, nil, nil},
+		{"CuSSE", etensor.FLOAT64, nil, nil},
+		{"CuPctCor", etensor.FLOAT64, nil, nil},
+		{"UcSSE", etensor.FLOAT64, nil, nil},
+		{"UcPctCor", etensor.FLOAT64, nil, nil},
 	}
 	/*for _, tn := range ss.TstNms {
 		for _, ts := range ss.TstStatNms {
@@ -2082,8 +2541,9 @@ func (ss *Sim) LogTstCyc(dt *etable.Table, cyc int) {
 
 	if cyc%10 == 0 { // too slow to do every cyc
 		// note: essential to use Go version of update when called from another goroutine
-		ss.TstCycPlot.GoUpdate()
+		ss.GoUpdatePlot(ss.TstCycPlot)
 	}
+	WriteLogRow(ss.TstCycFile, dt, cyc)
 }
 
 func (ss *Sim) ConfigTstCycLog(dt *etable.Table) {
@@ -2119,6 +2579,12 @@ func (ss *Sim) ConfigTstCycPlot(plt *eplot.Plot2D, dt *etable.Table) *eplot.Plot
 //////////////////////////////////////////////
 //  RunLog
 
+// RunStatNms are the TstEpcLog stats that are summarized at the end of each run
+var RunStatNms = []string{"ShSSE", "ShPctCor", "ShCosDiff", "UnSSE", "UnPctCor", "UnCosDiff", "CuSSE", "CuPctCor", "UcSSE", "UcPctCor"}
+
+// PreSlpStatNms are the RunLog stats from the last test before sleep (see SetPreSlpStats)
+var PreSlpStatNms = []string{"PreShSSE", "PreShPctCor", "PreUnSSE", "PreUnPctCor", "PreCuSSE", "PreCuPctCor", "PreUcSSE", "PreUcPctCor"}
+
 // LogRun adds data from current run to the RunLog table.
 func (ss *Sim) LogRun(dt *etable.Table) {
 	run := ss.TrainEnv.Run.Cur // this is NOT triggered by increment yet -- use Cur
@@ -2127,10 +2593,10 @@ func (ss *Sim) LogRun(dt *etable.Table) {
 
 	epclog := ss.TstEpcLog
 	epcix := etable.NewIdxView(epclog)
-	// compute mean over last N epochs for run level
+	// compute mean over last N epochs for run level -- there are none without testing (TestInterval <= 0)
 	nlast := 1
-	if nlast > epcix.Len()-1 {
-		nlast = epcix.Len() - 1
+	if nlast > epcix.Len() {
+		nlast = epcix.Len()
 	}
 	epcix.Idxs = epcix.Idxs[epcix.Len()-nlast:]
 
@@ -2139,16 +2605,30 @@ func (ss *Sim) LogRun(dt *etable.Table) {
 	dt.SetCellFloat("Run", row, float64(run))
 	dt.SetCellString("Params", row, params)
 	//dt.SetCellFloat("FirstZero", row, float64(ss.FirstZero)) // DS: Commente out to temporarily get rid of errors
-	dt.SetCellFloat("ShSSE", row, agg.Mean(epcix, "SSE")[0])
-	dt.SetCellFloat("AvgSSE", row, agg.Mean(epcix, "AvgSSE")[0])
-	dt.SetCellFloat("PctErr", row, agg.Mean(epcix, "PctErr")[0])
-	dt.SetCellFloat("PctCor", row, agg.Mean(epcix, "PctCor")[0])
-	dt.SetCellFloat("CosDiff", row, agg.Mean(epcix, "CosDiff")[0])
-	dt.SetCellFloat("SSE", row, agg.Mean(epcix, "SSE")[0])
-	dt.SetCellFloat("AvgSSE", row, agg.Mean(epcix, "AvgSSE")[0])
-	dt.SetCellFloat("PctErr", row, agg.Mean(epcix, "PctErr")[0])
-	dt.SetCellFloat("PctCor", row, agg.Mean(epcix, "PctCor")[0])
-	dt.SetCellFloat("CosDiff", row, agg.Mean(epcix, "CosDiff")[0])
+	for _, st := range RunStatNms {
+		if epcix.Len() > 0 {
+			dt.SetCellFloat(st, row, agg.Mean(epcix, st)[0])
+		} else {
+			dt.SetCellFloat(st, row, math.NaN())
+		}
+	}
+	dt.SetCellFloat("PreShSSE", row, ss.PreShSSE)
+	dt.SetCellFloat("PreShPctCor", row, ss.PreShPctCor)
+	dt.SetCellFloat("PreUnSSE", row, ss.PreUnSSE)
+	dt.SetCellFloat("PreUnPctCor", row, ss.PreUnPctCor)
+	dt.SetCellFloat("PreCuSSE", row, ss.PreCuSSE)
+	dt.SetCellFloat("PreCuPctCor", row, ss.PreCuPctCor)
+	dt.SetCellFloat("PreUcSSE", row, ss.PreUcSSE)
+	dt.SetCellFloat("PreUcPctCor", row, ss.PreUcPctCor)
+	dt.SetCellString("PlusThr", row, FmtThr(ss.PlusThr))
+	dt.SetCellString("MinusThr", row, FmtThr(ss.MinusThr))
+	dt.SetCellFloat("SlpNoiseN", row, float64(ss.RunNoiseN))
+
+	// all the seeds needed to replay this run exactly
+	SetCellInt64(dt, "Seed", row, ss.RndSeed)
+	for _, nm := range SeedStreams {
+		SetCellInt64(dt, nm+"Seed", row, ss.RunSeeds[nm])
+	}
 
 	/*
 		for _, tn := range ss.TstNms {
@@ -2159,23 +2639,20 @@ func (ss *Sim) LogRun(dt *etable.Table) {
 		}
 	*/
 
+	ss.RunStatsFmLog(dt)
+
+	// note: essential to use Go version of update when called from another goroutine
+	ss.GoUpdatePlot(ss.RunPlot)
+	WriteLogRow(ss.RunFile, dt, row)
+}
+
+// RunStatsFmLog computes the RunStats summary over all the runs in the RunLog
+func (ss *Sim) RunStatsFmLog(dt *etable.Table) {
 	runix := etable.NewIdxView(dt)
 	spl := split.GroupBy(runix, []string{"Params"})
-	for _, tn := range ss.TstNms {
-		nm := tn + " " + "Mem"
-		split.Desc(spl, nm)
-	}
-	split.Desc(spl, "FirstZero")
+	split.Desc(spl, "ShPctCor")
+	split.Desc(spl, "UnPctCor")
 	ss.RunStats = spl.AggsToTable(false)
-
-	// note: essential to use Go version of update when called from another goroutine
-	ss.RunPlot.GoUpdate()
-	//if ss.RunFile != nil {
-	//	if row == 0 {
-	//		dt.WriteCSVHeaders(ss.RunFile, etable.Tab)
-	//	}
-	//	dt.WriteCSVRow(ss.RunFile, row, etable.Tab, true)
-	//}
 }
 
 func (ss *Sim) ConfigRunLog(dt *etable.Table) {
@@ -2188,11 +2665,19 @@ func (ss *Sim) ConfigRunLog(dt *etable.Table) {
 		{"Run", etensor.INT64, nil, nil},
 		{"Params", etensor.STRING, nil, nil},
 		{"FirstZero", etensor.FLOAT64, nil, nil},
-		{"SSE", etensor.FLOAT64, nil, nil},
-		{"AvgSSE", etensor.FLOAT64, nil, nil},
-		{"PctErr", etensor.FLOAT64, nil, nil},
-		{"PctCor", etensor.FLOAT64, nil, nil},
-		{"CosDiff", etensor.FLOAT64, nil, nil},
+	}
+	for _, st := range RunStatNms {
+		sch = append(sch, etable.Column{st, etensor.FLOAT64, nil, nil})
+	}
+	for _, st := range PreSlpStatNms {
+		sch = append(sch, etable.Column{st, etensor.FLOAT64, nil, nil})
+	}
+	sch = append(sch, etable.Column{"PlusThr", etensor.STRING, nil, nil}) // see FmtThr
+	sch = append(sch, etable.Column{"MinusThr", etensor.STRING, nil, nil})
+	sch = append(sch, etable.Column{"SlpNoiseN", etensor.INT64, nil, nil})
+	sch = append(sch, etable.Column{"Seed", etensor.INT64, nil, nil})
+	for _, nm := range SeedStreams {
+		sch = append(sch, etable.Column{nm + "Seed", etensor.INT64, nil, nil})
 	}
 
 	/*
@@ -2212,11 +2697,19 @@ func (ss *Sim) ConfigRunPlot(plt *eplot.Plot2D, dt *etable.Table) *eplot.Plot2D
 	// order of params: on, fixMin, min, fixMax, max
 	plt.SetColParams("Run", false, true, 0, false, 0)
 	plt.SetColParams("FirstZero", false, true, 0, false, 0)
-	plt.SetColParams("SSE", false, true, 0, false, 0)
-	plt.SetColParams("AvgSSE", false, true, 0, false, 0)
-	plt.SetColParams("PctErr", false, true, 0, true, 1)
-	plt.SetColParams("PctCor", false, true, 0, true, 1)
-	plt.SetColParams("CosDiff", false, true, 0, true, 1)
+	plt.SetColParams("ShSSE", false, true, 0, false, 0)
+	plt.SetColParams("ShPctCor", true, true, 0, true, 1)
+	plt.SetColParams("ShCosDiff", false, true, 0, true, 1)
+	plt.SetColParams("UnSSE", false, true, 0, false, 0)
+	plt.SetColParams("UnPctCor", true, true, 0, true, 1)
+	plt.SetColParams("UnCosDiff", false, true, 0, true, 1)
+	for _, st := range PreSlpStatNms {
+		plt.SetColParams(st, false, true, 0, false, 0)
+	}
+	plt.SetColParams("Seed", false, true, 0, false, 0)
+	for _, nm := range SeedStreams {
+		plt.SetColParams(nm+"Seed", false, true, 0, false, 0)
+	}
 
 	/*
 		for _, tn := range ss.TstNms {
@@ -2294,6 +2787,9 @@ func (ss *Sim) ConfigGui() *gi.Window {
 	plt = tv.AddNewTab(eplot.KiT_Plot2D, "RunPlot").(*eplot.Plot2D)
 	ss.RunPlot = ss.ConfigRunPlot(plt, ss.RunLog)
 
+	plt = tv.AddNewTab(eplot.KiT_Plot2D, "PrjnWtPlot").(*eplot.Plot2D)
+	ss.PrjnWtPlot = ss.ConfigPrjnWtPlot(plt, ss.PrjnWtLog)
+
 	split.SetSplits(.3, .7)
 
 	tbar.AddAction(gi.ActOpts{Label: "Init", Icon: "update", Tooltip: "Initialize everything including network weights, and start over.  Also applies current params.", UpdateFunc: func(act *gi.Action) {
@@ -2504,57 +3000,50 @@ var SimProps = ki.Props{
 				}},
 			},
 		}},
+		{"OpenWeights", ki.Props{
+			"desc": "open network weights from file -- must use the same seed and run they were saved with",
+			"icon": "file-open",
+			"Args": ki.PropSlice{
+				{"File Name", ki.Props{
+					"ext": ".wts,.wts.gz",
+				}},
+			},
+		}},
+		{"SaveExptConfig", ki.Props{
+			"desc": "save the experiment configuration (Sim settings, Task and Slp) to a JSON file",
+			"icon": "file-save",
+			"Args": ki.PropSlice{
+				{"File Name", ki.Props{
+					"ext": ".json",
+				}},
+			},
+		}},
+		{"OpenExptConfig", ki.Props{
+			"desc": "open an experiment configuration JSON file -- press Init afterward for it to take effect",
+			"icon": "file-open",
+			"Args": ki.PropSlice{
+				{"File Name", ki.Props{
+					"ext": ".json",
+				}},
+			},
+		}},
+		{"SaveCheckpoint", ki.Props{
+			"desc": "save a checkpoint of the full state of the sim -- training weights, counters, stats, random streams and sleep state -- that Open Checkpoint resumes from",
+			"icon": "file-save",
+			"Args": ki.PropSlice{
+				{"File Name", ki.Props{
+					"ext": ".ckpt",
+				}},
+			},
+		}},
+		{"OpenCheckpoint", ki.Props{
+			"desc": "resume from a checkpoint -- Train then continues the run exactly where the checkpoint was saved",
+			"icon": "file-open",
+			"Args": ki.PropSlice{
+				{"File Name", ki.Props{
+					"ext": ".ckpt",
+				}},
+			},
+		}},
 	},
 }
-
-func (ss *Sim) CmdArgs() {
-	ss.NoGui = true
-	ss.NoGui = true
-	var nogui bool
-	var saveEpcLog bool
-	var saveRunLog bool
-	flag.StringVar(&ss.ParamSet, "params", "", "ParamSet name to use -- must be valid name as listed in compiled-in params or loaded params")
-	flag.StringVar(&ss.Tag, "tag", "", "extra tag to add to file names saved from this run")
-	flag.IntVar(&ss.MaxRuns, "runs", 30, "number of runs to do (note that MaxEpcs is in paramset)")
-	flag.BoolVar(&ss.LogSetParams, "setparams", false, "if true, print a record of each parameter that is set")
-	flag.BoolVar(&ss.SaveWts, "wts", false, "if true, save final weights after each run")
-	flag.BoolVar(&saveEpcLog, "epclog", true, "if true, save train epoch log to file")
-	flag.BoolVar(&saveRunLog, "runlog", false, "if true, save run epoch log to file")
-	flag.BoolVar(&nogui, "nogui", true, "if not passing any other args and want to run nogui, use nogui")
-	flag.Parse()
-	ss.Init()
-
-	if ss.ParamSet != "" {
-		fmt.Printf("Using ParamSet: %s\n", ss.ParamSet)
-	}
-
-	if saveEpcLog {
-		var err error
-		fnm := ss.LogFileName("epc" + strconv.Itoa(int(ss.RndSeed)))
-		ss.TrnEpcFile, err = os.Create(fnm)
-		if err != nil {
-			log.Println(err)
-			ss.TrnEpcFile = nil
-		} else {
-			fmt.Printf("Saving epoch log to: %v\n", fnm)
-			defer ss.TrnEpcFile.Close()
-		}
-	}
-	if saveRunLog {
-		var err error
-		fnm := ss.LogFileName("run")
-		ss.RunFile, err = os.Create(fnm)
-		if err != nil {
-			log.Println(err)
-			ss.RunFile = nil
-		} else {
-			fmt.Printf("Saving run log to: %v\n", fnm)
-			defer ss.RunFile.Close()
-		}
-	}
-	if ss.SaveWts {
-		fmt.Printf("Saving final weights per run\n")
-	}
-	fmt.Printf("Running %d Runs\n", ss.MaxRuns)
-	ss.Train()
-}
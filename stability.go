@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/schapirolab/leabra-sleep/leabra"
+	"gonum.org/v1/gonum/stat"
+)
+
+// StabilityMetrics are the types of StabilityMetric (see Slp.Stability)
+var StabilityMetrics = []string{"mean", "weighted", "hip", "cortex", "min", "window"}
+
+// HipLayers are the layers of the hippocampus, for the hip and cortex stability
+// metrics -- the rest of the layers are cortex
+var HipLayers = []string{"DG", "CA3", "CA1"}
+
+// StabilityMetric measures the stability of the network during sleep, which is
+// logged as AvgLaySim and drives the plus and minus phases
+type StabilityMetric interface {
+	// Stability returns the stability of the network at the current cycle, given
+	// the Sim of each of its layers -- the correlation of its activations with
+	// those of the last cycle, NaN where that is undefined (e.g., a layer with no
+	// activity), which counts as 0.  The contribution of each layer to it is set
+	// in contrib.
+	Stability(sims, contrib []float64) float64
+}
+
+// StabilityParams are the settings of the stability metric
+type StabilityParams struct {
+	Metric  string             `def:"mean" desc:"stability metric: mean = mean Sim of all the layers; weighted = mean weighted by layer (Weights); hip = mean over the hippocampus (DG, CA3, CA1); cortex = mean over the rest of the layers; min = lowest Sim of any layer; window = mean correlation of each layer's activations with those Window cycles before"`
+	Weights map[string]float64 `desc:"for weighted, weight of each layer, by name -- layers that aren't listed have a weight of 1"`
+	Window  int                `def:"5" min:"1" desc:"for window, number of cycles back that activations are correlated with -- until there are that many, the oldest ones of the sleep trial"`
+}
+
+// Defaults sets the default stability params
+func (sp *StabilityParams) Defaults() {
+	sp.Metric = "mean"
+	sp.Weights = nil
+	sp.Window = 5
+}
+
+// Validate returns a description of each problem with the stability params,
+// given the names of the layers of the network
+func (sp *StabilityParams) Validate(lays []string) []string {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	if !HasName(StabilityMetrics, sp.Metric) {
+		bad("Slp.Stability.Metric %q is not one of: %s", sp.Metric, strings.Join(StabilityMetrics, ", "))
+	}
+	lnms := make([]string, 0, len(sp.Weights))
+	for lnm := range sp.Weights {
+		lnms = append(lnms, lnm)
+	}
+	sort.Strings(lnms)
+	for _, lnm := range lnms {
+		if !HasName(lays, lnm) {
+			bad("Slp.Stability.Weights: %q is not a layer of the network", lnm)
+		}
+		if w := sp.Weights[lnm]; math.IsNaN(w) || w < 0 {
+			bad("Slp.Stability.Weights[%q] must be >= 0, is: %g", lnm, w)
+		}
+	}
+	if sp.Metric == "weighted" {
+		tot := 0.0
+		for _, lnm := range lays {
+			tot += sp.LayerWeight(lnm)
+		}
+		if !(tot > 0) {
+			bad("Slp.Stability.Weights must give some layer a weight > 0")
+		}
+	}
+	if sp.Window < 1 {
+		bad("Slp.Stability.Window must be >= 1, is: %d", sp.Window)
+	}
+	return errs
+}
+
+// LayerWeight returns the weight of the given layer for the weighted metric
+func (sp *StabilityParams) LayerWeight(lnm string) float64 {
+	if w, has := sp.Weights[lnm]; has {
+		return w
+	}
+	return 1
+}
+
+// MeanStab is a weighted mean of the Sim of the layers -- layers with a weight of 0
+// are left out
+type MeanStab struct {
+	Wts []float64
+}
+
+func (ms *MeanStab) Stability(sims, contrib []float64) float64 {
+	tot := 0.0
+	for _, w := range ms.Wts {
+		tot += w
+	}
+	stab := 0.0
+	for li, sim := range sims {
+		contrib[li] = 0
+		if ms.Wts[li] == 0 || math.IsNaN(sim) {
+			continue
+		}
+		contrib[li] = ms.Wts[li] * sim / tot
+		stab += ms.Wts[li] * sim
+	}
+	return stab / tot
+}
+
+// MinStab is the lowest Sim of any layer, which is that layer's contribution
+type MinStab struct{}
+
+func (ms *MinStab) Stability(sims, contrib []float64) float64 {
+	mli, min := 0, math.Inf(1)
+	for li, sim := range sims {
+		contrib[li] = 0
+		if math.IsNaN(sim) {
+			sim = 0
+		}
+		if sim < min {
+			mli, min = li, sim
+		}
+	}
+	contrib[mli] = min
+	return min
+}
+
+// ActHist is a ring of the activations of the network over the last cycles,
+// for the window metric -- it is part of the state of a sleep trial
+type ActHist struct {
+	Acts [][]float32 `desc:"activations of each neuron of the network, by cycle, with the one for cycle n in Acts[n % len(Acts)]"`
+	N    int         `desc:"number of cycles recorded"`
+}
+
+// WindowStab is the mean correlation of the activations of each layer with those
+// it had Window cycles before
+type WindowStab struct {
+	Net    *leabra.Network
+	Window int
+	Hist   *ActHist
+	Mean   MeanStab
+	lsims  []float64
+}
+
+func (ws *WindowStab) Stability(sims, contrib []float64) float64 {
+	h := ws.Hist
+	if len(h.Acts) != ws.Window {
+		*h = ActHist{Acts: make([][]float32, ws.Window)}
+	}
+	if len(ws.lsims) != len(sims) {
+		ws.lsims = make([]float64, len(sims))
+	}
+	var acts []float32
+	for _, lyi := range ws.Net.Layers {
+		for ni := range lyi.(*leabra.Layer).Neurons {
+			acts = append(acts, lyi.(*leabra.Layer).Neurons[ni].Act)
+		}
+	}
+	if h.N == 0 { // nothing to go back to yet
+		copy(ws.lsims, sims)
+	} else {
+		back := h.N - ws.Window
+		if back < 0 {
+			back = 0
+		}
+		prv := h.Acts[back%ws.Window]
+		st := 0
+		for li, lyi := range ws.Net.Layers {
+			n := len(lyi.(*leabra.Layer).Neurons)
+			ws.lsims[li] = stat.Correlation(Float64s(prv[st:st+n]), Float64s(acts[st:st+n]), nil)
+			st += n
+		}
+	}
+	h.Acts[h.N%ws.Window] = acts
+	h.N++
+	return ws.Mean.Stability(ws.lsims, contrib)
+}
+
+// Float64s returns the given values as float64s
+func Float64s(vals []float32) []float64 {
+	fs := make([]float64, len(vals))
+	for i, v := range vals {
+		fs[i] = float64(v)
+	}
+	return fs
+}
+
+// NewStabilityMetric returns the stability metric of Slp.Stability for the network
+func (ss *Sim) NewStabilityMetric() StabilityMetric {
+	sp := &ss.Slp.Stability
+	wts := make([]float64, len(ss.Net.Layers))
+	for li, ly := range ss.Net.Layers {
+		switch sp.Metric {
+		case "weighted":
+			wts[li] = sp.LayerWeight(ly.Name())
+		case "hip":
+			if HasName(HipLayers, ly.Name()) {
+				wts[li] = 1
+			}
+		case "cortex":
+			if !HasName(HipLayers, ly.Name()) {
+				wts[li] = 1
+			}
+		default:
+			wts[li] = 1
+		}
+	}
+	switch sp.Metric {
+	case "min":
+		return &MinStab{}
+	case "window":
+		return &WindowStab{Net: ss.Net, Window: sp.Window, Hist: &ss.StabHist, Mean: MeanStab{Wts: wts}}
+	}
+	return &MeanStab{Wts: wts}
+}
+
+// LaySimNaNs sets LayNaN for each layer whose Sim is undefined at the coming
+// cycle -- the network computes it at the start of the cycle, from the same
+// activations, but sets it to 0 if it is NaN
+func (ss *Sim) LaySimNaNs() {
+	if len(ss.LayNaN) != len(ss.Net.Layers) {
+		ss.LayNaN = make([]bool, len(ss.Net.Layers))
+	}
+	for li, lyi := range ss.Net.Layers {
+		ly := lyi.(*leabra.Layer)
+		prv := make([]float64, len(ly.Neurons))
+		cur := make([]float64, len(ly.Neurons))
+		for ni := range ly.Neurons {
+			prv[ni] = float64(ly.Neurons[ni].ActSent)
+			cur[ni] = float64(ly.Neurons[ni].Act)
+		}
+		ss.LayNaN[li] = math.IsNaN(stat.Correlation(prv, cur, nil))
+	}
+}
+
+// NaNLayers returns the names of the layers whose Sim was NaN at this cycle
+func (ss *Sim) NaNLayers() string {
+	var nms []string
+	for li, nan := range ss.LayNaN {
+		if nan {
+			nms = append(nms, ss.Net.Layers[li].Name())
+		}
+	}
+	return strings.Join(nms, " ")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/emer/emergent/emer"
+	"github.com/schapirolab/leabra-sleep/leabra"
+	"gonum.org/v1/gonum/stat"
+)
+
+func TestStability(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name    string
+		metric  StabilityMetric
+		sims    []float64
+		want    float64
+		contrib []float64
+	}{
+		{"mean", &MeanStab{Wts: []float64{1, 1, 1, 1}}, []float64{1, 0.8, 0.6, 0.2}, 0.65, []float64{0.25, 0.2, 0.15, 0.05}},
+		{"mean nan", &MeanStab{Wts: []float64{1, 1, 1, 1}}, []float64{1, nan, 0.6, 0.2}, 0.45, []float64{0.25, 0, 0.15, 0.05}},
+		{"weighted", &MeanStab{Wts: []float64{2, 0, 1, 1}}, []float64{1, 0.8, 0.6, 0.2}, 0.7, []float64{0.5, 0, 0.15, 0.05}},
+		{"hip", &MeanStab{Wts: []float64{0, 1, 1, 0}}, []float64{1, 0.8, 0.6, 0.2}, 0.7, []float64{0, 0.4, 0.3, 0}},
+		{"min", &MinStab{}, []float64{1, 0.8, 0.6, 0.2}, 0.2, []float64{0, 0, 0, 0.2}},
+		{"min nan", &MinStab{}, []float64{1, nan, 0.6, 0.2}, 0, []float64{0, 0, 0, 0}},
+		{"min neg", &MinStab{}, []float64{-0.5, 0.8, 0.6, 0.2}, -0.5, []float64{-0.5, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		contrib := []float64{9, 9, 9, 9}
+		got := tt.metric.Stability(tt.sims, contrib)
+		if math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s: Stability = %g, want %g", tt.name, got, tt.want)
+		}
+		sum := 0.0
+		for li, c := range contrib {
+			if math.Abs(c-tt.contrib[li]) > 1e-12 {
+				t.Errorf("%s: contrib[%d] = %g, want %g", tt.name, li, c, tt.contrib[li])
+			}
+			sum += c
+		}
+		if math.Abs(sum-got) > 1e-12 {
+			t.Errorf("%s: contribs sum to %g, not the stability %g", tt.name, sum, got)
+		}
+	}
+}
+
+func TestStabilityValidate(t *testing.T) {
+	lays := []string{"DG", "CA3", "CA1", "F1"}
+	tests := []struct {
+		sp   StabilityParams
+		nerr int
+	}{
+		{StabilityParams{Metric: "mean", Window: 5}, 0},
+		{StabilityParams{Metric: "median", Window: 5}, 1},
+		{StabilityParams{Metric: "weighted", Weights: map[string]float64{"CA3": 2}, Window: 5}, 0},
+		{StabilityParams{Metric: "weighted", Weights: map[string]float64{"DG": 0, "CA3": 0, "CA1": 0, "F1": 0}, Window: 5}, 1},
+		{StabilityParams{Metric: "weighted", Weights: map[string]float64{"CA4": 1, "DG": -1}, Window: 5}, 2},
+		{StabilityParams{Metric: "window", Window: 0}, 1},
+	}
+	for _, tt := range tests {
+		if errs := tt.sp.Validate(lays); len(errs) != tt.nerr {
+			t.Errorf("%+v: Validate = %q, want %d errors", tt.sp, errs, tt.nerr)
+		}
+	}
+}
+
+func TestWindowStab(t *testing.T) {
+	net := &leabra.Network{}
+	net.InitName(net, "test")
+	net.AddLayer2D("A", 1, 4, emer.Hidden)
+	net.AddLayer2D("B", 1, 3, emer.Hidden)
+	net.Defaults()
+	if err := net.Build(); err != nil {
+		t.Fatal(err)
+	}
+	acts := [][]float32{
+		{0.1, 0.5, 0.9, 0.2, 1, 0, 0.5},
+		{0.3, 0.2, 0.8, 0.9, 0, 1, 0.5},
+		{0.9, 0.1, 0.3, 0.4, 0.2, 0.4, 0.7},
+		{0.1, 0.5, 0.8, 0.3, 1, 0.1, 0.6},
+	}
+	const window = 2
+	ws := &WindowStab{Net: net, Window: window, Hist: &ActHist{}, Mean: MeanStab{Wts: []float64{1, 1}}}
+	sims := []float64{0.5, 0.25} // the layers' own Sim, only used at the first cycle
+	contrib := make([]float64, 2)
+	for cyc, ca := range acts {
+		i := 0
+		for _, lyi := range net.Layers {
+			ly := lyi.(*leabra.Layer)
+			for ni := range ly.Neurons {
+				ly.Neurons[ni].Act = ca[i]
+				i++
+			}
+		}
+		got := ws.Stability(sims, contrib)
+
+		want := (sims[0] + sims[1]) / 2
+		if cyc > 0 {
+			back := cyc - window
+			if back < 0 {
+				back = 0
+			}
+			pa, a := acts[back], acts[cyc]
+			want = (stat.Correlation(Float64s(pa[:4]), Float64s(a[:4]), nil) + stat.Correlation(Float64s(pa[4:]), Float64s(a[4:]), nil)) / 2
+		}
+		if math.Abs(got-want) > 1e-6 {
+			t.Errorf("cycle %d: Stability = %g, want %g", cyc, got, want)
+		}
+	}
+	if ws.Hist.N != len(acts) {
+		t.Errorf("Hist.N = %d, want %d", ws.Hist.N, len(acts))
+	}
+}
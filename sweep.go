@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/emer/emergent/params"
+	"github.com/emer/etable/agg"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/split"
+	"github.com/goki/gi/gi"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// SweepDim is one dimension of a parameter sweep: either a Network (or SynDep)
+// param under a params.Sheet selector (e.g., #CA3ToCA3 Prjn.Learn.Lrate), or, if
+// Sel is empty, a numeric field of the experiment config (e.g., Slp.SynDepInc).
+type SweepDim struct {
+	Sel   string    `desc:"params.Sheet selector of the Network param to sweep (e.g., #CA3ToCA3, .PerDGPrjn) -- empty to sweep a field of the experiment config instead"`
+	Param string    `desc:"param path under Sel (e.g., Prjn.Learn.Lrate, or Prjn.SynDep.Inc for the SynDep sheet) -- or, if Sel is empty, the path of an ExptConfig field (e.g., Slp.SynDepInc)"`
+	Vals  []float64 `desc:"values to use in a grid sweep"`
+	Min   float64   `desc:"lowest value to sample in a random sweep"`
+	Max   float64   `desc:"highest value to sample in a random sweep"`
+	Log   bool      `desc:"sample on a log scale in a random sweep, e.g., for learning rates -- Min must be > 0"`
+}
+
+// Name returns the name of the dim, used for its column in the SweepLog
+func (sd *SweepDim) Name() string {
+	if sd.Sel == "" {
+		return sd.Param
+	}
+	return sd.Sel + " " + sd.Param
+}
+
+// Sheet returns the params sheet of the dim: SynDep for the syn dep params of a
+// layer or prjn (see SynDepParams), else Network
+func (sd *SweepDim) Sheet() string {
+	if strings.HasPrefix(ParamPath(sd.Param), "SynDep.") {
+		return "SynDep"
+	}
+	return "Network"
+}
+
+// ParamPath returns the path of a param under its target type (e.g., Learn.Lrate
+// for Prjn.Learn.Lrate)
+func ParamPath(param string) string {
+	return strings.Join(strings.Split(param, ".")[1:], ".")
+}
+
+// Sample returns a value sampled uniformly from the Min - Max range (on a log scale if Log)
+func (sd *SweepDim) Sample(rnd *rand.Rand) float64 {
+	if sd.Log {
+		return math.Exp(math.Log(sd.Min) + rnd.Float64()*(math.Log(sd.Max)-math.Log(sd.Min)))
+	}
+	return sd.Min + rnd.Float64()*(sd.Max-sd.Min)
+}
+
+// SweepSpec specifies a parameter sweep, loaded from a JSON file (see OpenSweepSpec).
+// Each point of the sweep is trained and slept for Seeds runs.
+type SweepSpec struct {
+	Mode       string     `desc:"grid = every combination of the Vals of the dims, random = Samples points with each dim sampled from its Min - Max range"`
+	Samples    int        `desc:"number of points in a random sweep"`
+	SampleSeed int64      `desc:"random seed for sampling the points of a random sweep -- the seeds of the runs come from the master seed as usual"`
+	Seeds      int        `desc:"number of runs to do at each point -- every point uses the same runs, and thus the same derived seeds (see SeedStreams)"`
+	Dims       []SweepDim `desc:"the params and config fields that are swept"`
+}
+
+// SweepPoint is one point of a sweep, with a value for each of the dims
+type SweepPoint struct {
+	Idx  int
+	Vals []float64
+}
+
+// Points returns the points of the sweep, in order
+func (sp *SweepSpec) Points() []SweepPoint {
+	var pts []SweepPoint
+	switch sp.Mode {
+	case "grid":
+		n := 1
+		for _, sd := range sp.Dims {
+			n *= len(sd.Vals)
+		}
+		for pi := 0; pi < n; pi++ { // first dim varies slowest
+			vals := make([]float64, len(sp.Dims))
+			ri := pi
+			for di := len(sp.Dims) - 1; di >= 0; di-- {
+				nv := len(sp.Dims[di].Vals)
+				vals[di] = sp.Dims[di].Vals[ri%nv]
+				ri /= nv
+			}
+			pts = append(pts, SweepPoint{Idx: pi, Vals: vals})
+		}
+	case "random":
+		rnd := rand.New(rand.NewSource(sp.SampleSeed))
+		for pi := 0; pi < sp.Samples; pi++ {
+			vals := make([]float64, len(sp.Dims))
+			for di := range sp.Dims {
+				vals[di] = sp.Dims[di].Sample(rnd)
+			}
+			pts = append(pts, SweepPoint{Idx: pi, Vals: vals})
+		}
+	}
+	return pts
+}
+
+// Validate checks the sweep spec against the sim it will be run on, returning an
+// error that lists every problem found, or nil if it is ok.  Each point must also
+// give a valid experiment config.
+func (sp *SweepSpec) Validate(ss *Sim) error {
+	var errs []string
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	if sp.Mode != "grid" && sp.Mode != "random" {
+		bad("Mode must be grid or random, is: %q", sp.Mode)
+	}
+	if sp.Mode == "random" && sp.Samples <= 0 {
+		bad("Samples must be > 0 for a random sweep, is: %d", sp.Samples)
+	}
+	if sp.Seeds <= 0 {
+		bad("Seeds must be > 0, is: %d", sp.Seeds)
+	}
+	if len(sp.Dims) == 0 {
+		bad("Dims must list at least one param to sweep")
+	}
+	for di := range sp.Dims {
+		sd := &sp.Dims[di]
+		switch sp.Mode {
+		case "grid":
+			if len(sd.Vals) == 0 {
+				bad("Dims[%d] %s: Vals must be given for a grid sweep", di, sd.Name())
+			}
+		case "random":
+			if !(sd.Min <= sd.Max) {
+				bad("Dims[%d] %s: Min must be <= Max, are: %g, %g", di, sd.Name(), sd.Min, sd.Max)
+			}
+			if sd.Log && sd.Min <= 0 {
+				bad("Dims[%d] %s: Min must be > 0 for Log sampling, is: %g", di, sd.Name(), sd.Min)
+			}
+		}
+		var err error
+		if sd.Sel == "" {
+			err = SetConfigField(ss.ExptConfig(), sd.Param, 0)
+		} else {
+			err = NetParamCheck(ss.Net, sd.Sel, sd.Param)
+		}
+		if err != nil {
+			bad("Dims[%d]: %v", di, err)
+		}
+	}
+	if len(errs) == 0 {
+		for _, pt := range sp.Points() {
+			ec := ss.ExptConfig()
+			sp.ApplyConfig(ec, &pt)
+			if err := ec.Validate(ss); err != nil {
+				bad("point %d %v gives an invalid config:\n    %v", pt.Idx, pt.Vals, strings.Replace(err.Error(), "\n", "\n  ", -1))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// ApplyConfig sets the config fields swept by the spec to their values at the given point
+func (sp *SweepSpec) ApplyConfig(ec *ExptConfig, pt *SweepPoint) {
+	for di := range sp.Dims {
+		sd := &sp.Dims[di]
+		if sd.Sel == "" {
+			SetConfigField(ec, sd.Param, pt.Vals[di])
+		}
+	}
+}
+
+// PointParams returns a copy of the given param sets with the Network (and SynDep)
+// params swept by the spec set to their values at the given point.  They are added
+// as extra selectors at the end of the sheet of the ParamSet (or Base if none),
+// which is applied last, so they take precedence over the other params.
+func (sp *SweepSpec) PointParams(pss params.Sets, paramSet string, pt *SweepPoint) params.Sets {
+	setNm := paramSet
+	if setNm == "" {
+		setNm = "Base"
+	}
+	cp := make(params.Sets, len(pss))
+	copy(cp, pss)
+	for si, ps := range cp {
+		if ps.Name != setNm {
+			continue
+		}
+		nps := *ps
+		nps.Sheets = make(params.Sheets, len(ps.Sheets)+2)
+		for nm, sh := range ps.Sheets {
+			nps.Sheets[nm] = sh
+		}
+		nshs := make(map[string]*params.Sheet)
+		for di := range sp.Dims {
+			sd := &sp.Dims[di]
+			if sd.Sel == "" {
+				continue
+			}
+			shnm := sd.Sheet()
+			nsh, has := nshs[shnm]
+			if !has {
+				nsh = &params.Sheet{}
+				if sh, has := ps.Sheets[shnm]; has {
+					*nsh = append(*nsh, *sh...)
+				}
+				nshs[shnm] = nsh
+			}
+			*nsh = append(*nsh, &params.Sel{Sel: sd.Sel, Desc: fmt.Sprintf("sweep point %d", pt.Idx),
+				Params: params.Params{sd.Param: strconv.FormatFloat(pt.Vals[di], 'g', -1, 64)}})
+		}
+		for nm, nsh := range nshs {
+			nps.Sheets[nm] = nsh
+		}
+		cp[si] = &nps
+	}
+	return cp
+}
+
+// SetConfigField sets the numeric field of the config at the given dot-separated
+// path (e.g., Slp.SynDepInc) to the given value, returning an error if there is
+// no such numeric field
+func SetConfigField(ec *ExptConfig, path string, val float64) error {
+	fv := reflect.ValueOf(ec).Elem()
+	for _, fnm := range strings.Split(path, ".") {
+		if fv.Kind() != reflect.Struct {
+			return fmt.Errorf("config field %s: %s is not a struct", path, fv.Type())
+		}
+		fv = fv.FieldByName(fnm)
+		if !fv.IsValid() {
+			return fmt.Errorf("config field %s: no field named %s", path, fnm)
+		}
+	}
+	switch fv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		fv.SetFloat(val)
+	case reflect.Int, reflect.Int64:
+		fv.SetInt(int64(math.Round(val)))
+	case reflect.Bool:
+		fv.SetBool(val != 0)
+	default:
+		return fmt.Errorf("config field %s: must be a number or bool to sweep, is: %s", path, fv.Type())
+	}
+	return nil
+}
+
+// NetParamCheck returns an error if the given selector doesn't match any layer or
+// prjn of the network of the param's target type (Layer or Prjn), or if the param
+// path doesn't exist on them -- or on their syn dep params, for SynDep params
+func NetParamCheck(net *leabra.Network, sel, param string) error {
+	trg := strings.Split(param, ".")[0]
+	path := ParamPath(param)
+	syndep := strings.HasPrefix(path, "SynDep.")
+	var objs []params.Styler
+	for _, lyi := range net.Layers {
+		ly := lyi.(leabra.LeabraLayer).AsLeabra()
+		switch {
+		case trg == "Layer" && syndep:
+			objs = append(objs, &LayerSynDep{Layer: ly})
+		case trg == "Layer":
+			objs = append(objs, ly)
+		case trg == "Prjn":
+			for _, pj := range ly.RcvPrjns {
+				if syndep {
+					objs = append(objs, &PrjnSynDep{Prjn: pj.(leabra.LeabraPrjn)})
+				} else {
+					objs = append(objs, pj)
+				}
+			}
+		default:
+			return fmt.Errorf("param %s: must start with Layer. or Prjn.", param)
+		}
+	}
+	for _, obj := range objs {
+		if !params.SelMatch(sel, obj.Name(), obj.Class(), obj.TypeName(), "") {
+			continue
+		}
+		if _, err := params.FindParam(reflect.ValueOf(obj), path); err != nil {
+			return fmt.Errorf("param %s: not found on %s %s", param, trg, obj.Name())
+		}
+		return nil
+	}
+	return fmt.Errorf("selector %s: does not match any %s in the network", sel, trg)
+}
+
+// OpenSweepSpec loads a sweep spec from the given JSON file and validates it.
+// Unknown fields are an error, to catch typos.
+func (ss *Sim) OpenSweepSpec(filename gi.FileName) (*SweepSpec, error) {
+	b, err := ioutil.ReadFile(string(filename))
+	if err != nil {
+		return nil, err
+	}
+	sp := &SweepSpec{Mode: "grid", Seeds: 1}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(sp); err != nil {
+		var serr *json.SyntaxError
+		if errors.As(err, &serr) {
+			return nil, fmt.Errorf("%s:%d: %v", filename, LineOfOffset(b, serr.Offset), err)
+		}
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if err := sp.Validate(ss); err != nil {
+		return nil, fmt.Errorf("%s: invalid sweep:\n  %v", filename, err)
+	}
+	return sp, nil
+}
+
+// SweepStatNms are the RunLog stats that are summarized per point in the SweepLog
+var SweepStatNms = []string{"PreShPctCor", "ShPctCor", "PreUnPctCor", "UnPctCor", "PreShSSE", "ShSSE", "PreUnSSE", "UnSSE"}
+
+// RunSweep trains and sleeps Seeds runs, starting at TrainEnv.Run.Cur, for every
+// point of the sweep, with up to nprocs runs going at the same time (0 = one per
+// CPU core), each on its own Sim from NewBatchSim.  Logs (for each of lognms) are
+// saved per run, with the point and run numbers added to their names.  Returns the
+// SweepLog, with a row per point that has the value of each dim and the mean and
+// standard deviation over its runs of the pre- and post-sleep test stats.
+// If interrupted (see Interrupt), the runs that are underway save their logs and
+// are left out, along with the runs that haven't started.
+func (ss *Sim) RunSweep(sp *SweepSpec, nprocs int, lognms []string) *etable.Table {
+	pts := sp.Points()
+	first := ss.TrainEnv.Run.Cur
+	njobs := len(pts) * sp.Seeds
+	if nprocs <= 0 {
+		nprocs = runtime.NumCPU()
+	}
+	if nprocs > njobs {
+		nprocs = njobs
+	}
+	fmt.Printf("Sweeping %d points x %d seeds, %d runs at a time\n", len(pts), sp.Seeds, nprocs)
+
+	runlogs := make([]*etable.Table, njobs)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for p := 0; p < nprocs; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ss.IsInterrupted() { // skip the runs that haven't started
+					continue
+				}
+				pt := &pts[job/sp.Seeds]
+				run := first + job%sp.Seeds
+				bs := ss.NewBatchSim(run, lognms, func(bs *Sim) {
+					ec := bs.ExptConfig()
+					sp.ApplyConfig(ec, pt)
+					bs.ApplyExptConfig(ec)
+					bs.Params = sp.PointParams(bs.Params, bs.ParamSet, pt)
+					bs.LogSfx = fmt.Sprintf("_pt%03d_run%03d", pt.Idx, run)
+				})
+				if ss.AddBatchSim(bs) {
+					bs.Train()
+					ss.DeleteBatchSim(bs)
+				}
+				if bs.IsInterrupted() {
+					bs.FlushLogs()
+					bs.CloseLogFiles()
+					continue
+				}
+				bs.CloseLogFiles()
+				runlogs[job] = bs.RunLog
+				fmt.Printf("Done point %d %v run %d\n", pt.Idx, pt.Vals, run)
+			}
+		}()
+	}
+	for job := 0; job < njobs; job++ {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+
+	sch := etable.Schema{
+		{"Point", etensor.INT64, nil, nil},
+		{"Run", etensor.INT64, nil, nil},
+	}
+	for di := range sp.Dims {
+		sch = append(sch, etable.Column{sp.Dims[di].Name(), etensor.FLOAT64, nil, nil})
+	}
+	for _, st := range SweepStatNms {
+		sch = append(sch, etable.Column{st, etensor.FLOAT64, nil, nil})
+	}
+	dt := etable.New(sch, 0)
+	for job, rl := range runlogs {
+		if rl == nil { // interrupted
+			continue
+		}
+		pt := &pts[job/sp.Seeds]
+		for row := 0; row < rl.Rows; row++ {
+			drow := dt.Rows
+			dt.SetNumRows(drow + 1)
+			dt.SetCellFloat("Point", drow, float64(pt.Idx))
+			dt.SetCellFloat("Run", drow, rl.CellFloat("Run", row))
+			for di := range sp.Dims {
+				dt.SetCellFloat(sp.Dims[di].Name(), drow, pt.Vals[di])
+			}
+			for _, st := range SweepStatNms {
+				dt.SetCellFloat(st, drow, rl.CellFloat(st, row))
+			}
+		}
+	}
+
+	spl := split.GroupBy(etable.NewIdxView(dt), []string{"Point"})
+	split.Agg(spl, "Run", agg.AggCount)
+	for _, st := range SweepStatNms {
+		split.Agg(spl, st, agg.AggMean)
+		split.Agg(spl, st, agg.AggStd)
+	}
+	swl := spl.AggsToTableCopy(etable.AddAggName)
+	swl.SetMetaData("name", "SweepLog")
+	swl.SetMetaData("desc", "pre- and post-sleep test stats at each point of a parameter sweep")
+	swl.SetMetaData("precision", strconv.Itoa(LogPrec))
+	return swl
+}
+
+// SweepLogFileName returns the name of the file the SweepLog is saved to
+func (ss *Sim) SweepLogFileName() string {
+	return ss.OutFile(ss.Net.Nm + "_" + ss.RunName() + "_sweep.tsv")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emer/emergent/params"
+)
+
+func TestSweepPointsGrid(t *testing.T) {
+	sp := &SweepSpec{Mode: "grid", Dims: []SweepDim{{Vals: []float64{1, 2}}, {Vals: []float64{10, 20, 30}}}}
+	want := [][]float64{{1, 10}, {1, 20}, {1, 30}, {2, 10}, {2, 20}, {2, 30}} // first dim varies slowest
+	pts := sp.Points()
+	if len(pts) != len(want) {
+		t.Fatalf("%d points, want %d", len(pts), len(want))
+	}
+	for i, pt := range pts {
+		if pt.Idx != i || !reflect.DeepEqual(pt.Vals, want[i]) {
+			t.Errorf("point %d = %d %v, want %d %v", i, pt.Idx, pt.Vals, i, want[i])
+		}
+	}
+	sp.Dims = append(sp.Dims, SweepDim{})
+	if pts := sp.Points(); len(pts) != 0 {
+		t.Errorf("%d points with a dim that has no values, want none", len(pts))
+	}
+}
+
+func TestSweepPointsRandom(t *testing.T) {
+	sp := &SweepSpec{Mode: "random", Samples: 20, SampleSeed: 3, Dims: []SweepDim{
+		{Min: -1, Max: 1},
+		{Min: 1e-4, Max: 1e-1, Log: true},
+	}}
+	pts := sp.Points()
+	if len(pts) != 20 {
+		t.Fatalf("%d points, want 20", len(pts))
+	}
+	nsmall := 0
+	for _, pt := range pts {
+		if pt.Vals[0] < -1 || pt.Vals[0] > 1 || pt.Vals[1] < 1e-4 || pt.Vals[1] > 1e-1 {
+			t.Errorf("point %d %v is out of range", pt.Idx, pt.Vals)
+		}
+		if pt.Vals[1] < 1e-2 {
+			nsmall++
+		}
+	}
+	if nsmall < 8 { // 2/3 of them on a log scale, 1/10 on a linear one
+		t.Errorf("%d of 20 log samples are < 1e-2, want about 13", nsmall)
+	}
+	if again := sp.Points(); !reflect.DeepEqual(pts, again) {
+		t.Errorf("the same SampleSeed gave different points:\n%v\n%v", pts, again)
+	}
+	sp.SampleSeed = 4
+	if other := sp.Points(); reflect.DeepEqual(pts, other) {
+		t.Errorf("a different SampleSeed gave the same points")
+	}
+}
+
+// TestPointParams checks that the params of a point are added to a copy of the
+// ParamSet, so the param sets shared by every point of the sweep are unchanged
+func TestPointParams(t *testing.T) {
+	base := &params.Sheet{{Sel: "Prjn", Params: params.Params{"Prjn.Learn.Lrate": "0.04"}}}
+	pss := params.Sets{
+		{Name: "Base", Sheets: params.Sheets{"Network": base}},
+		{Name: "Other", Sheets: params.Sheets{"Network": &params.Sheet{}}},
+	}
+	sp := &SweepSpec{Mode: "grid", Dims: []SweepDim{
+		{Sel: "#CA3ToCA3", Param: "Prjn.Learn.Lrate", Vals: []float64{0.2}},
+		{Param: "Slp.SynDepInc", Vals: []float64{0.001}},
+	}}
+	pt := sp.Points()[0]
+	cp := sp.PointParams(pss, "", &pt)
+
+	if len(*base) != 1 || pss[0].Sheets["Network"] != base || (*base)[0].Params["Prjn.Learn.Lrate"] != "0.04" {
+		t.Errorf("the shared Base Network sheet was changed: %v", *base)
+	}
+	if cp[1] != pss[1] {
+		t.Errorf("a set that isn't swept was copied")
+	}
+	sh := *cp[0].Sheets["Network"]
+	if len(sh) != 2 || sh[0] != (*base)[0] {
+		t.Fatalf("Network sheet of the point = %v, want the Base sheet and then the point", sh)
+	}
+	if sel := sh[1]; sel.Sel != "#CA3ToCA3" || len(sel.Params) != 1 || sel.Params["Prjn.Learn.Lrate"] != "0.2" {
+		t.Errorf("point params = %s %v, want #CA3ToCA3 Prjn.Learn.Lrate: 0.2", sel.Sel, sel.Params)
+	}
+}
+
+func TestSetConfigField(t *testing.T) {
+	tests := []struct {
+		path string
+		val  float64
+		err  string // part of the error, "" for none
+	}{
+		{"Slp.SynDepInc", 0.002, ""},
+		{"MaxEpcs", 7.6, ""},
+		{"ExecSleep", 0, ""},
+		{"MaxEpc", 1, "no field named MaxEpc"},
+		{"Slp.Cycels", 1, "no field named Cycels"},
+		{"MaxEpcs.Max", 1, "is not a struct"},
+		{"Tag", 1, "must be a number or bool"},
+		{"Slp", 1, "must be a number or bool"},
+	}
+	for _, tt := range tests {
+		ec := &ExptConfig{MaxEpcs: 50, ExecSleep: true}
+		err := SetConfigField(ec, tt.path, tt.val)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.path, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: error %v, want %q", tt.path, err, tt.err)
+		}
+	}
+	ec := &ExptConfig{ExecSleep: true}
+	SetConfigField(ec, "Slp.SynDepInc", 0.002)
+	SetConfigField(ec, "MaxEpcs", 7.6)
+	SetConfigField(ec, "ExecSleep", 0)
+	if ec.Slp.SynDepInc != 0.002 || ec.MaxEpcs != 8 || ec.ExecSleep {
+		t.Errorf("Slp.SynDepInc, MaxEpcs, ExecSleep = %g, %d, %v, want 0.002, 8 (rounded), false", ec.Slp.SynDepInc, ec.MaxEpcs, ec.ExecSleep)
+	}
+}
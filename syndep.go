@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/emer/emergent/params"
+	"github.com/goki/mat32"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// SynDepModels are the models of synaptic depression during sleep (see Slp.SynDepModel):
+// ca = the Ca-based depression of leabra-sleep, driven by sender-receiver
+// co-activity; tm = Tsodyks-Markram style depletion of the synaptic resources,
+// driven by sender activity alone
+var SynDepModels = []string{"ca", "tm"}
+
+// SynDepParams are the rates of synaptic depression of a prjn.  They default to
+// Slp.SynDepInc and SynDepDec, and can be set for each layer (for all of its
+// sending prjns) or prjn in the SynDep sheet of the param sets, e.g.,
+// {Sel: "#CA3ToCA3", Params: {"Prjn.SynDep.Inc": "0.001"}}
+type SynDepParams struct {
+	Inc float32 `desc:"rate at which depression increases -- for ca, the rate at which Ca builds up with sender-receiver co-activity; for tm, the fraction of the resources used per cycle of full sender activity"`
+	Dec float32 `desc:"rate at which depression recovers -- for ca, the rate at which Ca decays; for tm, the fraction of the used resources recovered per cycle"`
+}
+
+// LayerSynDep is the syn dep params of a layer, which are the defaults of its
+// sending prjns -- the target of the Layer selectors of the SynDep params sheet
+type LayerSynDep struct {
+	Layer  *leabra.Layer
+	SynDep SynDepParams
+}
+
+func (ld *LayerSynDep) TypeName() string { return "Layer" }
+func (ld *LayerSynDep) Class() string    { return ld.Layer.Class() }
+func (ld *LayerSynDep) Name() string     { return ld.Layer.Name() }
+
+// PrjnSynDep is the syn dep params of a prjn -- the target of the Prjn selectors
+// of the SynDep params sheet
+type PrjnSynDep struct {
+	Prjn   leabra.LeabraPrjn
+	SynDep SynDepParams
+}
+
+func (pd *PrjnSynDep) TypeName() string { return "Prjn" }
+func (pd *PrjnSynDep) Class() string    { return pd.Prjn.Class() }
+func (pd *PrjnSynDep) Name() string     { return pd.Prjn.Name() }
+
+// SynDepPrjns returns the prjns that depress during sleep, in the order of
+// SlpSynDeps: the sending prjns of each layer, as with InitSdEffWt
+func (ss *Sim) SynDepPrjns() []leabra.LeabraPrjn {
+	var pjs []leabra.LeabraPrjn
+	for _, lyi := range ss.Net.Layers {
+		for _, pji := range lyi.(leabra.LeabraLayer).AsLeabra().SndPrjns {
+			if pji.IsOff() {
+				continue
+			}
+			pjs = append(pjs, pji.(leabra.LeabraPrjn))
+		}
+	}
+	return pjs
+}
+
+// PrjnSynDeps returns the syn dep params of each prjn (see SynDepPrjns), from the
+// given sleep params and the SynDep sheets of the Base and given param sets
+func (ss *Sim) PrjnSynDeps(sp *SleepParams, paramSet string, setMsg bool) ([]*PrjnSynDep, error) {
+	setNms := []string{"Base"}
+	if paramSet != "" && paramSet != "Base" {
+		setNms = append(setNms, paramSet)
+	}
+	var shs []*params.Sheet
+	for _, nm := range setNms {
+		pset, err := ss.Params.SetByNameTry(nm)
+		if err != nil {
+			return nil, err
+		}
+		if sh, has := pset.Sheets["SynDep"]; has {
+			shs = append(shs, sh)
+		}
+	}
+	apply := func(obj params.Styler) error {
+		for _, sh := range shs {
+			if _, err := sh.Apply(obj, setMsg); err != nil {
+				return fmt.Errorf("%s %s: %v", obj.TypeName(), obj.Name(), err)
+			}
+		}
+		return nil
+	}
+
+	lds := make(map[string]*LayerSynDep, len(ss.Net.Layers))
+	for _, lyi := range ss.Net.Layers {
+		ld := &LayerSynDep{Layer: lyi.(leabra.LeabraLayer).AsLeabra(), SynDep: SynDepParams{Inc: sp.SynDepInc, Dec: sp.SynDepDec}}
+		if err := apply(ld); err != nil {
+			return nil, err
+		}
+		lds[ld.Name()] = ld
+	}
+	pjs := ss.SynDepPrjns()
+	pds := make([]*PrjnSynDep, len(pjs))
+	for i, pj := range pjs {
+		pds[i] = &PrjnSynDep{Prjn: pj, SynDep: lds[pj.SendLay().Name()].SynDep}
+		if err := apply(pds[i]); err != nil {
+			return nil, err
+		}
+	}
+	return pds, nil
+}
+
+// InitSynDep sets the synapses up for sleep, with the synaptic depression of each
+// prjn (SlpSynDeps) if on, or without any if not, and starts it over
+func (ss *Sim) InitSynDep(on bool) {
+	for _, pd := range ss.SlpSynDeps {
+		inc, dec := pd.SynDep.Inc, pd.SynDep.Dec
+		if !on || ss.Slp.SynDepModel != "ca" { // tm depresses the synapses itself, in SynDepCyc
+			inc, dec = 0, 0
+		}
+		pd.Prjn.InitSdEffWt(inc, dec)
+	}
+	ss.SynDepOn = on
+}
+
+// SynDepCyc is called after each cycle of sleep.  It records the mean depression
+// of the effective weights (1 - Effwt / Wt) of each prjn in PrjnDep, and, with the
+// tm model, uses up and recovers the resources of the synapses.  The network
+// depresses the effective weights by (1 - Cai)^2, so the fraction of the resources
+// that is left, x, is kept in Cai as 1 - sqrt(x).
+func (ss *Sim) SynDepCyc() {
+	if len(ss.PrjnDep) != len(ss.SlpSynDeps) {
+		ss.PrjnDep = make([]float64, len(ss.SlpSynDeps))
+	}
+	tm := ss.Slp.SynDepModel == "tm"
+	for pi, pd := range ss.SlpSynDeps {
+		ss.PrjnDep[pi] = 0
+		if !ss.SynDepOn {
+			continue
+		}
+		pj := pd.Prjn.AsLeabra()
+		if len(pj.Syns) == 0 {
+			continue
+		}
+		dep := 0.0
+		for si := range pj.Syns {
+			dep += float64(1 - pj.Syns[si].SynDepFac)
+		}
+		ss.PrjnDep[pi] = dep / float64(len(pj.Syns))
+		if !tm {
+			continue
+		}
+		inc, dec := pd.SynDep.Inc, pd.SynDep.Dec
+		slay := pj.Send.(leabra.LeabraLayer).AsLeabra()
+		for si := range slay.Neurons {
+			nrn := &slay.Neurons[si]
+			if nrn.IsOff() {
+				continue
+			}
+			st := int(pj.SConIdxSt[si])
+			syns := pj.Syns[st : st+int(pj.SConN[si])]
+			for ci := range syns {
+				sy := &syns[ci]
+				x := (1 - sy.Cai) * (1 - sy.Cai)
+				x += dec*(1-x) - inc*x*nrn.Act
+				x = mat32.Min(mat32.Max(x, 0), 1)
+				sy.Cai = 1 - mat32.Sqrt(x)
+			}
+		}
+	}
+}
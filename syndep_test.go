@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/emer/emergent/emer"
+	"github.com/emer/emergent/prjn"
+	"github.com/schapirolab/leabra-sleep/hip"
+	"github.com/schapirolab/leabra-sleep/leabra"
+)
+
+// newTestNet returns a small network, built and initialized: layer A (1x3) sending
+// to layer B (1x2) through a full CHL prjn, as in the hippocampus of the sim
+func newTestNet(t *testing.T) (*leabra.Network, *hip.CHLPrjn) {
+	t.Helper()
+	net := &leabra.Network{}
+	net.InitName(net, "test")
+	a := net.AddLayer2D("A", 1, 3, emer.Hidden)
+	b := net.AddLayer2D("B", 1, 2, emer.Hidden)
+	pj := net.ConnectLayersPrjn(a, b, prjn.NewFull(), emer.Forward, &hip.CHLPrjn{}).(*hip.CHLPrjn)
+	net.Defaults()
+	if err := net.Build(); err != nil {
+		t.Fatal(err)
+	}
+	net.InitWts()
+	return net, pj
+}
+
+// TestSynDepTM checks that the tm resources of each synapse settle where use
+// balances recovery, dec / (dec + inc * act), and recover fully without activity
+func TestSynDepTM(t *testing.T) {
+	net, pj := newTestNet(t)
+	ss := &Sim{Net: net, SynDepOn: true}
+	ss.Slp.SynDepModel = "tm"
+	inc, dec := float32(0.2), float32(0.05)
+	ss.SlpSynDeps = []*PrjnSynDep{{Prjn: pj, SynDep: SynDepParams{Inc: inc, Dec: dec}}}
+	a := net.LayerByName("A").(*leabra.Layer)
+	res := func(si int) float32 { // resources left at the synapses of sender si
+		sy := &pj.Syns[pj.SConIdxSt[si]]
+		return (1 - sy.Cai) * (1 - sy.Cai)
+	}
+
+	acts := []float32{1, 0.5, 0}
+	for si := range a.Neurons {
+		a.Neurons[si].Act = acts[si]
+	}
+	for cyc := 0; cyc < 500; cyc++ {
+		ss.SynDepCyc()
+	}
+	for si, act := range acts {
+		if got, want := res(si), dec/(dec+inc*act); math.Abs(float64(got-want)) > 1e-4 {
+			t.Errorf("sender act %g: resources = %g, want %g", act, got, want)
+		}
+	}
+
+	for si := range a.Neurons {
+		a.Neurons[si].Act = 0
+	}
+	for cyc := 0; cyc < 500; cyc++ {
+		ss.SynDepCyc()
+	}
+	for si := range acts {
+		if got := res(si); got < 0.9999 {
+			t.Errorf("sender %d: resources = %g after recovering, want 1", si, got)
+		}
+	}
+}
+
+func TestSynDepCycPrjnDep(t *testing.T) {
+	net, pj := newTestNet(t)
+	ss := &Sim{Net: net}
+	ss.Slp.SynDepModel = "ca"
+	ss.SlpSynDeps = []*PrjnSynDep{{Prjn: pj, SynDep: SynDepParams{Inc: 0.2, Dec: 0.05}}}
+	for si := range pj.Syns {
+		pj.Syns[si].SynDepFac = 1 - 0.1*float32(si) // 0 .. 0.5 depressed
+		pj.Syns[si].Cai = 0.3
+	}
+	ss.SynDepCyc()
+	if ss.PrjnDep[0] != 0 {
+		t.Errorf("PrjnDep = %g with syn dep off, want 0", ss.PrjnDep[0])
+	}
+	ss.SynDepOn = true
+	ss.SynDepCyc()
+	if got := ss.PrjnDep[0]; math.Abs(got-0.25) > 1e-6 {
+		t.Errorf("PrjnDep = %g, want the mean depression 0.25", got)
+	}
+	if pj.Syns[0].Cai != 0.3 {
+		t.Errorf("the ca model changed Cai to %g -- the network depresses the synapses itself", pj.Syns[0].Cai)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/emer/etable/eplot"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// PrjnWts returns the weights of the synapses of each prjn, in the order of
+// SynDepPrjns -- the snapshot that PrjnWtLog measures the changes from
+func (ss *Sim) PrjnWts() [][]float32 {
+	pjs := ss.SynDepPrjns()
+	wts := make([][]float32, len(pjs))
+	for i, pji := range pjs {
+		pj := pji.AsLeabra()
+		wts[i] = make([]float32, len(pj.Syns))
+		for si := range pj.Syns {
+			wts[i][si] = pj.Syns[si].Wt
+		}
+	}
+	return wts
+}
+
+// LogPrjnWt adds a row to the PrjnWtLog, with the mean |dWt| of each prjn since the
+// last snapshot of the weights (WtSnap) -- NaN if there is none -- and its mean
+// weight and weight variance, and takes a new snapshot.  typ is wake (after a
+// training epoch) or sleep (every Slp.WtLogCycs cycles, and at the end).
+func (ss *Sim) LogPrjnWt(dt *etable.Table, typ string) {
+	wss := ss.PrjnWtStats()
+	wts := ss.PrjnWts()
+
+	row := dt.Rows
+	dt.SetNumRows(row + 1)
+	dt.SetCellFloat("Run", row, float64(ss.TrainEnv.Run.Cur))
+	epc, bout, cyc := ss.TrainEnv.Epoch.Prv, 0, 0 // the epoch that just ended, as in LogTrnEpc
+	if typ == "sleep" {
+		epc, bout, cyc = ss.TrainEnv.Epoch.Cur, ss.SlpBout+1, ss.SlpCyc
+	}
+	dt.SetCellFloat("Epoch", row, float64(epc))
+	dt.SetCellFloat("Snap", row, float64(row))
+	dt.SetCellString("Type", row, typ)
+	dt.SetCellFloat("Bout", row, float64(bout))
+	dt.SetCellFloat("Cycle", row, float64(cyc))
+	for i, pji := range ss.SynDepPrjns() {
+		nm := pji.Name()
+		dwt := math.NaN()
+		if i < len(ss.WtSnap) && len(ss.WtSnap[i]) == len(wts[i]) && len(wts[i]) > 0 {
+			sum := 0.0
+			for si, wt := range wts[i] {
+				sum += math.Abs(float64(wt - ss.WtSnap[i][si]))
+			}
+			dwt = sum / float64(len(wts[i]))
+		}
+		dt.SetCellFloat(nm+" dWt", row, dwt)
+		dt.SetCellFloat(nm+" Wt", row, wss[i].Mean)
+		dt.SetCellFloat(nm+" WtVar", row, wss[i].Var)
+	}
+	ss.WtSnap = wts
+
+	ss.GoUpdatePlot(ss.PrjnWtPlot)
+	WriteLogRow(ss.PrjnWtFile, dt, row)
+}
+
+// ConfigPrjnWtLog configures the PrjnWtLog, with a row per snapshot of the weights
+// in the run
+func (ss *Sim) ConfigPrjnWtLog(dt *etable.Table) {
+	dt.SetMetaData("name", "PrjnWtLog")
+	dt.SetMetaData("desc", "Mean |dWt| of each prjn since the last snapshot, and its mean weight and weight variance, after each training epoch and every Slp.WtLogCycs cycles of sleep")
+	dt.SetMetaData("read-only", "true")
+	dt.SetMetaData("precision", strconv.Itoa(LogPrec))
+
+	sch := etable.Schema{
+		{"Run", etensor.INT64, nil, nil},
+		{"Epoch", etensor.INT64, nil, nil},
+		{"Snap", etensor.INT64, nil, nil},
+		{"Type", etensor.STRING, nil, nil},
+		{"Bout", etensor.INT64, nil, nil},
+		{"Cycle", etensor.INT64, nil, nil},
+	}
+	for _, pj := range ss.SynDepPrjns() {
+		sch = append(sch, etable.Column{pj.Name() + " dWt", etensor.FLOAT64, nil, nil})
+		sch = append(sch, etable.Column{pj.Name() + " Wt", etensor.FLOAT64, nil, nil})
+		sch = append(sch, etable.Column{pj.Name() + " WtVar", etensor.FLOAT64, nil, nil})
+	}
+	dt.SetFromSchema(sch, 0)
+}
+
+func (ss *Sim) ConfigPrjnWtPlot(plt *eplot.Plot2D, dt *etable.Table) *eplot.Plot2D {
+	plt.Params.Title = "Sleep-replay Prjn Weight Plot"
+	plt.Params.XAxisCol = "Snap"
+	plt.SetTable(dt)
+	// order of params: on, fixMin, min, fixMax, max
+	plt.SetColParams("Run", false, true, 0, false, 0)
+	plt.SetColParams("Epoch", false, true, 0, false, 0)
+	plt.SetColParams("Snap", false, true, 0, false, 0)
+	plt.SetColParams("Bout", false, true, 0, false, 0)
+	plt.SetColParams("Cycle", false, true, 0, false, 0)
+	for _, pj := range ss.SynDepPrjns() {
+		plt.SetColParams(pj.Name()+" dWt", true, true, 0, false, 0)
+		plt.SetColParams(pj.Name()+" Wt", false, true, 0, true, 1)
+		plt.SetColParams(pj.Name()+" WtVar", false, true, 0, false, 0)
+	}
+	return plt
+}
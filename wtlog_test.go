@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/emer/etable/etable"
+)
+
+// TestLogPrjnWt takes three snapshots of the weights, with changes before the
+// second, and checks the mean |dWt| of each since the one before
+func TestLogPrjnWt(t *testing.T) {
+	net, pj := newTestNet(t)
+	ss := &Sim{Net: net, PrjnWtLog: &etable.Table{}}
+	dt := ss.PrjnWtLog
+	ss.ConfigPrjnWtLog(dt)
+	nm := pj.Name()
+	for si := range pj.Syns {
+		pj.Syns[si].Wt = 0.5
+	}
+	ss.LogPrjnWt(dt, "wake")
+	for si := range pj.Syns {
+		pj.Syns[si].Wt += 0.1 * float32(1-2*(si%2)) // half of them down
+	}
+	ss.SlpCyc = 300
+	ss.LogPrjnWt(dt, "sleep")
+	ss.LogPrjnWt(dt, "sleep")
+
+	if dt.Rows != 3 {
+		t.Fatalf("%d rows, want 3", dt.Rows)
+	}
+	if dwt := dt.CellFloat(nm+" dWt", 0); !math.IsNaN(dwt) {
+		t.Errorf("first snapshot: dWt = %g, want NaN", dwt)
+	}
+	for row, want := range []float64{0.1, 0} {
+		if dwt := dt.CellFloat(nm+" dWt", row+1); math.Abs(dwt-want) > 1e-6 {
+			t.Errorf("snapshot %d: dWt = %g, want %g", row+1, dwt, want)
+		}
+	}
+	if wt := dt.CellFloat(nm+" Wt", 1); math.Abs(wt-0.5) > 1e-6 {
+		t.Errorf("mean Wt = %g, want 0.5", wt)
+	}
+	if typ, cyc := dt.CellString("Type", 1), dt.CellFloat("Cycle", 1); typ != "sleep" || cyc != 300 {
+		t.Errorf("Type, Cycle = %s, %g, want sleep, 300", typ, cyc)
+	}
+}